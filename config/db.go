@@ -4,11 +4,15 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/mailer"
 )
 
 type AppConfig struct {
@@ -16,22 +20,118 @@ type AppConfig struct {
 	MongoDB       string
 	RedisAddr     string
 	RedisPassword string
+	// PaperRetention is how long a soft-deleted paper stays restorable
+	// before the purge job removes it for good.
+	PaperRetention time.Duration
+	// TokenSecret signs access tokens. AccessTokenTTL should stay short
+	// since access tokens are only revocable through a Redis denylist.
+	TokenSecret     []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// SessionSecret authenticates session cookies.
+	SessionSecret []byte
+	// AppBaseURL prefixes the links put into outgoing email.
+	AppBaseURL string
+	// TOTPIssuer is the account label shown in authenticator apps.
+	TOTPIssuer string
+	// Failed logins are counted per username and per client IP over
+	// LoginFailureWindow. Reaching LoginMaxFailures locks the username for
+	// LoginLockout; reaching LoginMaxFailuresPerIP refuses further attempts
+	// from that IP until old failures age out of the window.
+	LoginFailureWindow    time.Duration
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginLockout          time.Duration
+	// Request quotas per caller. RateAPI covers every authenticated route
+	// not in a bucket of its own; RatePublic covers unauthenticated routes,
+	// counted per IP. RateIP counts all authenticated traffic per IP before
+	// credentials are checked; it is higher than RateAPI since several users
+	// can share an address.
+	RateAPI    Rate
+	RateSearch Rate
+	RateCreate Rate
+	RatePublic Rate
+	RateIP     Rate
+	// PasswordHashing is the policy new password hashes are made with.
+	// Hashes made under another policy are upgraded at the next login.
+	PasswordHashing PasswordHashing
+	// Background jobs only run on the instance holding the scheduler lease.
+	// A leader that dies without releasing it is replaced after JobLeaseTTL.
+	JobLeaseTTL time.Duration
+	// ShutdownTimeout bounds how long in-flight requests and running jobs
+	// get to finish after SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration
+}
+
+// PasswordHashing selects "argon2id" or "bcrypt" and their cost
+// parameters. Argon2Memory is in KiB.
+type PasswordHashing struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// Rate is a request quota: at most Limit requests in any Window.
+type Rate struct {
+	Limit  int
+	Window time.Duration
 }
 
+// minSecretLen is the shortest signing secret accepted; HS256 wants a key
+// at least as long as its 32-byte output.
+const minSecretLen = 32
+
 var (
 	MongoClient *mongo.Client
 	Redis       *redis.Client
+	Mail        mailer.Mailer
 	Cfg         AppConfig
 )
 
 func Init() {
 	Cfg = AppConfig{
-		MongoURI:      getEnv("MONGO_URI", "mongodb://localhost:27017"),
-		MongoDB:       getEnv("MONGO_DB", "research_db"),
-		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", "123456"),
+		MongoURI:        getEnv("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDB:         getEnv("MONGO_DB", "research_db"),
+		RedisAddr:       getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:   getEnv("REDIS_PASSWORD", "123456"),
+		PaperRetention:  getDuration("PAPER_RETENTION", 30*24*time.Hour),
+		TokenSecret:     requireSecret("TOKEN_SECRET"),
+		SessionSecret:   requireSecret("SESSION_SECRET"),
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		AppBaseURL:      getEnv("APP_BASE_URL", "http://localhost:8080"),
+		TOTPIssuer:      getEnv("TOTP_ISSUER", "Research DB"),
+
+		LoginFailureWindow:    getDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginMaxFailures:      getInt("LOGIN_MAX_FAILURES", 10),
+		LoginMaxFailuresPerIP: getInt("LOGIN_MAX_FAILURES_PER_IP", 50),
+		LoginLockout:          getDuration("LOGIN_LOCKOUT", 15*time.Minute),
+
+		RateAPI:    getRate("RATE_LIMIT_API", Rate{300, time.Minute}),
+		RateSearch: getRate("RATE_LIMIT_SEARCH", Rate{60, time.Minute}),
+		RateCreate: getRate("RATE_LIMIT_CREATE", Rate{20, time.Minute}),
+		RatePublic: getRate("RATE_LIMIT_PUBLIC", Rate{30, time.Minute}),
+		RateIP:     getRate("RATE_LIMIT_IP", Rate{1200, time.Minute}),
+
+		PasswordHashing: PasswordHashing{
+			Algorithm:     getEnv("PASSWORD_HASH", "argon2id"),
+			BcryptCost:    getInt("BCRYPT_COST", 12),
+			Argon2Time:    uint32(getInt("ARGON2_TIME", 2)),
+			Argon2Memory:  uint32(getInt("ARGON2_MEMORY_KIB", 19*1024)),
+			Argon2Threads: uint8(getInt("ARGON2_THREADS", 1)),
+		},
+
+		JobLeaseTTL:     getDuration("JOB_LEASE_TTL", 30*time.Second),
+		ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
 	}
 
+	switch a := Cfg.PasswordHashing.Algorithm; a {
+	case "argon2id", "bcrypt":
+	default:
+		log.Fatalf("unknown PASSWORD_HASH %q", a)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -45,7 +145,6 @@ func Init() {
 	}
 	MongoClient = client
 
-
 	Redis = redis.NewClient(&redis.Options{
 		Addr:     Cfg.RedisAddr,
 		Password: Cfg.RedisPassword,
@@ -55,6 +154,35 @@ func Init() {
 		log.Fatalf("redis ping: %v", err)
 	}
 
+	switch kind := getEnv("MAILER", "log"); kind {
+	case "smtp":
+		Mail = mailer.SMTPMailer{
+			Addr:     getEnv("SMTP_ADDR", "localhost:25"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     getEnv("MAIL_FROM", "no-reply@localhost"),
+		}
+	case "log":
+		Mail = &mailer.LogMailer{Path: os.Getenv("MAILER_FILE")}
+	default:
+		log.Fatalf("unknown MAILER %q", kind)
+	}
+
+}
+
+// requireSecret reads the signing secret in env. Anyone who knows one can
+// forge tokens or sessions for any user, so there is no silent default:
+// INSECURE_DEV_SECRETS=1 opts a local setup into fixed, publicly known ones.
+func requireSecret(env string) []byte {
+	secret := []byte(os.Getenv(env))
+	if len(secret) == 0 && os.Getenv("INSECURE_DEV_SECRETS") == "1" {
+		log.Printf("WARNING: %s is unset, using the insecure development secret", env)
+		return []byte("insecure-dev-" + strings.ToLower(env) + "-do-not-deploy")
+	}
+	if len(secret) < minSecretLen {
+		log.Fatalf("%s must be set to at least %d bytes", env, minSecretLen)
+	}
+	return secret
 }
 
 func getEnv(k, def string) string {
@@ -63,3 +191,42 @@ func getEnv(k, def string) string {
 	}
 	return def
 }
+
+func getDuration(k string, def time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("invalid %s: %q", k, v)
+	}
+	return d
+}
+
+func getInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid %s: %q", k, v)
+	}
+	return n
+}
+
+// getRate reads a quota written as "<limit>/<window>", e.g. "60/1m".
+func getRate(k string, def Rate) Rate {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	limit, window, ok := strings.Cut(v, "/")
+	n, err1 := strconv.Atoi(limit)
+	d, err2 := time.ParseDuration(window)
+	if !ok || err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+		log.Fatalf("invalid %s: %q", k, v)
+	}
+	return Rate{Limit: n, Window: d}
+}
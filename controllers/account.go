@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"DB_HW5/config"
+	"DB_HW5/mailer"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	purposePasswordReset = "password_reset"
+	purposeVerifyEmail   = "verify_email"
+
+	passwordResetTTL = time.Hour
+	verifyEmailTTL   = 48 * time.Hour
+)
+
+// issueOneTimeToken creates a signed token for purpose and remembers value
+// under it for ttl. Any earlier token of the same purpose for the user stops
+// working.
+func issueOneTimeToken(ctx context.Context, purpose, userID, value string, ttl time.Duration) (string, error) {
+	token, id := utils.NewSignedToken(config.Cfg.TokenSecret, purpose)
+	userKey := utils.OneTimeTokenUserKey(purpose, userID)
+	if old, err := config.Redis.Get(ctx, userKey).Result(); err == nil {
+		_ = config.Redis.Del(ctx, utils.OneTimeTokenKey(purpose, old)).Err()
+	}
+	if err := config.Redis.Set(ctx, utils.OneTimeTokenKey(purpose, id), value, ttl).Err(); err != nil {
+		return "", err
+	}
+	_ = config.Redis.Set(ctx, userKey, id, ttl).Err()
+	return token, nil
+}
+
+// peekOneTimeToken is consumeOneTimeToken without the consuming.
+func peekOneTimeToken(ctx context.Context, purpose, token string) (string, bool, error) {
+	id, ok := utils.VerifySignedToken(config.Cfg.TokenSecret, purpose, token)
+	if !ok {
+		return "", false, nil
+	}
+	v, err := config.Redis.Get(ctx, utils.OneTimeTokenKey(purpose, id)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// consumeOneTimeToken checks the signature and atomically takes the stored
+// value, so each token works at most once.
+func consumeOneTimeToken(ctx context.Context, purpose, token string) (string, bool, error) {
+	id, ok := utils.VerifySignedToken(config.Cfg.TokenSecret, purpose, token)
+	if !ok {
+		return "", false, nil
+	}
+	v, err := config.Redis.GetDel(ctx, utils.OneTimeTokenKey(purpose, id)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+func sendVerificationEmail(ctx context.Context, userID, email string) error {
+	token, err := issueOneTimeToken(ctx, purposeVerifyEmail, userID, userID+"|"+email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	link := config.Cfg.AppBaseURL + "/verify-email?token=" + url.QueryEscape(token)
+	return config.Mail.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Open the link below within %s to confirm this address:\n\n%s\n\n"+
+			"If you did not sign up, ignore this message.\n", verifyEmailTTL, link),
+	})
+}
+
+// VerifyEmail confirms the address a verification link was sent to. The
+// link stops working if the user has changed their email since, and an
+// address another account has already verified cannot be verified again.
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var b struct {
+			Token string `json:"token"`
+		}
+		_ = c.ShouldBindJSON(&b)
+		token = b.Token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	v, ok, err := consumeOneTimeToken(ctx, purposeVerifyEmail, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	userID, email, _ := strings.Cut(v, "|")
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if !ok || err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+
+	res, err := config.MongoClient.Database("research_db").Collection("users").UpdateOne(ctx,
+		bson.M{"_id": uid, "email": email},
+		bson.M{"$set": bson.M{"email_verified": true}})
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+func ResendVerificationEmail(c *gin.Context) {
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var u struct {
+		Email         string `bson:"email"`
+		EmailVerified bool   `bson:"email_verified"`
+	}
+	if err := config.MongoClient.Database("research_db").Collection("users").
+		FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+		return
+	}
+	if u.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+	if err := sendVerificationEmail(ctx, uid.Hex(), u.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+type ForgotPasswordBody struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword mails a reset link to the account that has verified the
+// given email. Unverified addresses get nothing, since anyone could have
+// typed them in at signup. The response is the same either way.
+func ForgotPassword(c *gin.Context) {
+	var b ForgotPasswordBody
+	if err := c.BindJSON(&b); err != nil || !utils.ValidEmail(b.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	accepted := gin.H{"message": "If an account uses that address, a reset link has been sent"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var u struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := config.MongoClient.Database("research_db").Collection("users").
+		FindOne(ctx, bson.M{"email": b.Email, "email_verified": true}).Decode(&u); err != nil {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	token, err := issueOneTimeToken(ctx, purposePasswordReset, u.ID.Hex(), u.ID.Hex(), passwordResetTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	if err := config.Mail.Send(ctx, mailer.Message{
+		To:      b.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this token within %s to choose a new password:\n\n%s\n\n"+
+			"POST it to %s/password/reset together with new_password.\n"+
+			"If you did not ask for this, ignore this message.\n", passwordResetTTL, token, config.Cfg.AppBaseURL),
+	}); err != nil {
+		log.Printf("password reset mail to %s: %v", b.Email, err)
+	}
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+type ResetPasswordBody struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ResetPassword sets a new password from a reset token and logs the account
+// out everywhere.
+func ResetPassword(c *gin.Context) {
+	var b ResetPasswordBody
+	if err := c.BindJSON(&b); err != nil || b.Token == "" || b.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Look before consuming, so a password that fails the strength check
+	// does not burn the token.
+	userID, ok, err := peekOneTimeToken(ctx, purposePasswordReset, b.Token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if !ok || err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	users := config.MongoClient.Database("research_db").Collection("users")
+	var u models.User
+	if err := users.FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if err := utils.CheckPasswordStrength(b.NewPassword, u.Username, u.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok, err := consumeOneTimeToken(ctx, purposePasswordReset, b.Token); err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		return
+	}
+
+	hashed, err := utils.HashPassword(b.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "hash error"})
+		return
+	}
+	if _, err := users.UpdateByID(ctx, uid, bson.M{"$set": bson.M{"password": hashed}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	_ = config.Redis.Del(ctx, utils.OneTimeTokenUserKey(purposePasswordReset, userID)).Err()
+	if _, err := endSessions(ctx, userID, nil, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password changed but sessions could not be revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset"})
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	apiKeyPrefix      = "rdb_"
+	maxAPIKeysPerUser = 20
+	// lastUsedGranularity bounds how often a busy key writes last_used_at.
+	lastUsedGranularity = time.Minute
+)
+
+// scopePermissions lists what each API key scope allows. Account
+// management is deliberately absent: keys cannot mint keys, change
+// passwords or manage sessions.
+var scopePermissions = map[string][]Permission{
+	models.ScopeReadPapers:  {PermReadPapers},
+	models.ScopeWritePapers: {PermReadPapers, PermWritePapers, PermCuratePapers},
+	models.ScopeAdmin:       {PermReadPapers, PermWritePapers, PermCuratePapers, PermCurateAuthors, PermManageUsers},
+}
+
+// scopeRequires is the permission the caller's roles must include to create
+// a key with the scope.
+var scopeRequires = map[string]Permission{
+	models.ScopeReadPapers:  PermReadPapers,
+	models.ScopeWritePapers: PermWritePapers,
+	models.ScopeAdmin:       PermManageUsers,
+}
+
+func scopesAllow(scopes []string, perm Permission) bool {
+	for _, s := range scopes {
+		if slices.Contains(scopePermissions[s], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyAuth looks up the key in an "Authorization: ApiKey <key>" header.
+// ok reports whether such a header was sent at all.
+func apiKeyAuth(ctx context.Context, c *gin.Context) (key models.APIKey, ok bool, err error) {
+	raw, found := strings.CutPrefix(c.GetHeader("Authorization"), "ApiKey ")
+	if !found {
+		return key, false, nil
+	}
+	coll := config.MongoClient.Database("research_db").Collection("api_keys")
+	err = coll.FindOne(ctx, bson.M{"hash": utils.TokenHash(strings.TrimSpace(raw))}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return key, true, utils.ErrInvalidToken
+	}
+	if err != nil {
+		return key, true, err
+	}
+	now := time.Now().UTC()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return key, true, utils.ErrExpiredToken
+	}
+	_, _ = coll.UpdateOne(ctx, bson.M{"_id": key.ID, "$or": bson.A{
+		bson.M{"last_used_at": bson.M{"$exists": false}},
+		bson.M{"last_used_at": bson.M{"$lt": now.Add(-lastUsedGranularity)}},
+	}}, bson.M{"$set": bson.M{"last_used_at": now}})
+	return key, true, nil
+}
+
+type CreateAPIKeyBody struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey issues a new key for the caller. The key itself is only ever
+// returned here.
+func CreateAPIKey(c *gin.Context) {
+	var b CreateAPIKeyBody
+	if err := c.BindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if !utils.ValidNonEmptyMax(b.Name, 100) || len(b.Scopes) == 0 ||
+		(b.ExpiresAt != nil && !b.ExpiresAt.After(time.Now())) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fields"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	slices.Sort(b.Scopes)
+	b.Scopes = slices.Compact(b.Scopes)
+	for _, s := range b.Scopes {
+		perm, known := scopeRequires[s]
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + s})
+			return
+		}
+		if !hasPermission(ctx, c, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "your roles do not allow scope " + s})
+			return
+		}
+	}
+
+	coll := config.MongoClient.Database("research_db").Collection("api_keys")
+	n, err := coll.CountDocuments(ctx, bson.M{"user_id": uid})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if n >= maxAPIKeysPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many api keys"})
+		return
+	}
+
+	raw := apiKeyPrefix + utils.RandomToken(32)
+	key := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    uid,
+		Name:      b.Name,
+		Prefix:    raw[:len(apiKeyPrefix)+6],
+		Hash:      utils.TokenHash(raw),
+		Scopes:    b.Scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: b.ExpiresAt,
+	}
+	if _, err := coll.InsertOne(ctx, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": raw})
+}
+
+func ListAPIKeys(c *gin.Context) {
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	cur, err := config.MongoClient.Database("research_db").Collection("api_keys").Find(ctx,
+		bson.M{"user_id": uid}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	keys := []models.APIKey{}
+	if err := cur.All(ctx, &keys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	res, err := config.MongoClient.Database("research_db").Collection("api_keys").
+		DeleteOne(ctx, bson.M{"_id": id, "user_id": uid})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
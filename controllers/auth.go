@@ -2,11 +2,13 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"DB_HW5/config"
+	"DB_HW5/models"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -36,11 +38,14 @@ func SignUp(c *gin.Context) {
 	if !utils.ValidUsername(b.Username) ||
 		!utils.ValidNonEmptyMax(b.Name, 100) ||
 		!utils.ValidEmail(b.Email) ||
-		len(b.Password) < 8 ||
 		!utils.ValidNonEmptyMax(b.Department, 100) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fields"})
 		return
 	}
+	if err := utils.CheckPasswordStrength(b.Password, b.Username, b.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -54,17 +59,32 @@ func SignUp(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": "username already taken (redis)"})
 		return
 	}
+	taken, err := config.MongoClient.Database("research_db").Collection("users").
+		CountDocuments(ctx, bson.M{"email": b.Email, "email_verified": true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+		return
+	}
 
-	hashed, _ := utils.HashPassword(b.Password)
+	hashed, err := utils.HashPassword(b.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "hash error"})
+		return
+	}
 	u := bson.M{
-		"username":   b.Username,
-		"name":       b.Name,
-		"email":      b.Email,
-		"password":   hashed,
-		"department": b.Department,
+		"username":       b.Username,
+		"name":           b.Name,
+		"email":          b.Email,
+		"password":       hashed,
+		"department":     b.Department,
+		"email_verified": false,
 	}
 
-	command := bson.D{{"insert", "users"}, {"documents", []interface{}{u}}}
+	command := bson.D{{Key: "insert", Value: "users"}, {Key: "documents", Value: []interface{}{u}}}
 	var result bson.M
 	if err := config.MongoClient.Database("research_db").RunCommand(ctx, command).Decode(&result); err != nil {
 
@@ -93,12 +113,19 @@ func SignUp(c *gin.Context) {
 
 	_ = config.Redis.HSet(ctx, utils.RedisHashUsernames, b.Username, 1).Err()
 
+	if err := sendVerificationEmail(ctx, id, b.Email); err != nil {
+		log.Printf("verification mail to %s: %v", b.Email, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered", "user_id": id})
 }
 
 type LoginBody struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// IssueTokens asks for an access/refresh token pair in addition to the
+	// session cookie, for clients that cannot keep cookies.
+	IssueTokens bool `json:"issue_tokens"`
 }
 
 func Login(c *gin.Context) {
@@ -111,6 +138,10 @@ func Login(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if !loginAllowed(ctx, c, b.Username) {
+		return
+	}
+
 	command := bson.D{
 		{Key: "find", Value: "users"},
 		{Key: "filter", Value: bson.M{"username": b.Username}},
@@ -118,44 +149,145 @@ func Login(c *gin.Context) {
 	}
 	var result bson.M
 	if err := config.MongoClient.Database("research_db").RunCommand(ctx, command).Decode(&result); err != nil {
-		fmt.Printf("Database error: %v", err)
+		log.Printf("login lookup of %s: %v", b.Username, err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
 	docs, _ := result["cursor"].(bson.M)["firstBatch"].(primitive.A)
 	if len(docs) == 0 {
-		fmt.Printf("Document error?")
+		recordLoginFailure(ctx, c, b.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 	u := docs[0].(bson.M)
 
 	if !utils.CheckPassword(b.Password, u["password"].(string)) {
-		fmt.Println(u["password"].(string))
-		fmt.Printf("Password error?")
+		recordLoginFailure(ctx, c, b.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
+	userID := u["_id"].(primitive.ObjectID).Hex()
+	if utils.NeedsRehash(u["password"].(string)) {
+		// The stored hash predates the current policy; now is the only
+		// time the plaintext is at hand to upgrade it.
+		if hashed, err := utils.HashPassword(b.Password); err == nil {
+			_, _ = config.MongoClient.Database("research_db").Collection("users").UpdateOne(ctx,
+				bson.M{"_id": u["_id"], "password": u["password"]},
+				bson.M{"$set": bson.M{"password": hashed}})
+		}
+	}
+	if enabled, _ := u["totp_enabled"].(bool); enabled {
+		token, err := startLoginChallenge(ctx, userID, u["username"].(string), b.IssueTokens)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Two-factor code required",
+			"mfa_required": true,
+			"mfa_token":    token,
+		})
+		return
+	}
+
+	resp := gin.H{"message": "Login successful", "user_id": userID}
+	if roles, _ := u["roles"].(primitive.A); slices.Contains(roles, any(models.RoleAdmin)) {
+		// Admin powers stay switched off until the account enrolls.
+		resp["mfa_enrollment_required"] = true
+	}
+	completeLogin(ctx, c, userID, u["username"].(string), b.IssueTokens, resp)
+}
+
+// completeLogin establishes a session for a user who has passed every login
+// factor and writes resp, plus tokens if asked for, as the response.
+func completeLogin(ctx context.Context, c *gin.Context, userID, username string, issue bool, resp gin.H) {
+	method := "session"
+	if issue {
+		method = "token"
+	}
+	sid, err := startSession(ctx, c, userID, method)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session"})
+		return
+	}
+
+	clearLoginFailures(ctx, username)
+
 	session := sessions.Default(c)
-	session.Set("user_id", u["_id"].(primitive.ObjectID).Hex())
-	session.Set("username", u["username"].(string))
+	session.Set("user_id", userID)
+	session.Set("username", username)
+	session.Set("sid", sid)
 	if err := session.Save(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "user_id": u["_id"].(primitive.ObjectID).Hex()})
+	if issue {
+		tokens, err := issueTokens(ctx, userID, sid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue tokens"})
+			return
+		}
+		for k, v := range tokens {
+			resp[k] = v
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
 
-		userID := c.GetHeader("X-User-ID")
-		if userID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing X-User-ID header"})
-			c.Abort()
+		if key, ok, err := apiKeyAuth(ctx, c); ok {
+			if err == utils.ErrInvalidToken || err == utils.ErrExpiredToken {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized (api key " + err.Error() + ")"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", key.UserID.Hex())
+			c.Set("api_key_id", key.ID.Hex())
+			c.Set("api_key_scopes", key.Scopes)
+			c.Set("auth_method", "api_key")
+			c.Next()
+			return
+		}
+
+		if claims, ok, err := bearerClaims(ctx, c); ok {
+			if err == utils.ErrInvalidToken || err == utils.ErrExpiredToken {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized (" + err.Error() + ")"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+				c.Abort()
+				return
+			}
+			live, err := touchSession(ctx, c, claims.Subject, claims.SessionID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+				c.Abort()
+				return
+			}
+			if !live {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized (session revoked)"})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", claims.Subject)
+			c.Set("session_id", claims.SessionID)
+			c.Set("auth_method", "token")
+			c.Next()
 			return
 		}
 
@@ -168,13 +300,37 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		if storedUserID.(string) != userID {
+		userID := storedUserID.(string)
+
+		// X-User-ID is no longer needed, but callers that still send it
+		// must send the right one.
+		if h := c.GetHeader("X-User-ID"); h != "" && h != userID {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized (invalid user)"})
 			c.Abort()
 			return
 		}
 
+		sid, _ := session.Get("sid").(string)
+		live := false
+		if sid != "" {
+			var err error
+			if live, err = touchSession(ctx, c, userID, sid); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+				c.Abort()
+				return
+			}
+		}
+		if !live {
+			session.Clear()
+			_ = session.Save()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized (session revoked)"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", userID)
+		c.Set("session_id", sid)
+		c.Set("auth_method", "session")
 		c.Next()
 	}
 }
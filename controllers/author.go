@@ -0,0 +1,417 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+var authorMetricSorts = map[string]string{
+	"h_index":         "h_index",
+	"i10_index":       "i10_index",
+	"total_citations": "total_citations",
+	"papers":          "papers",
+}
+
+// refreshMetricsAround schedules a metrics refresh for the given authors and
+// for the authors of every paper paperID cites, since their citation counts
+// move together with it.
+func refreshMetricsAround(ctx context.Context, paperID primitive.ObjectID, authors []string) {
+	names := append([]string{}, authors...)
+	pipeline := append(citationNeighbourPipeline(paperID, true),
+		bson.M{"$project": bson.M{"authors": 1}})
+	cur, err := config.MongoClient.Database("research_db").Collection("citations").Aggregate(ctx, pipeline)
+	if err == nil {
+		var cited []struct {
+			Authors []string `bson:"authors"`
+		}
+		if cur.All(ctx, &cited) == nil {
+			for _, p := range cited {
+				names = append(names, p.Authors...)
+			}
+		}
+	}
+	utils.RefreshAuthorMetricsAsync(names)
+}
+
+// GetAuthorMetrics returns the metrics of the author given by ?name=, or the
+// top authors ordered by ?sort= (h_index by default) when no name is given.
+func GetAuthorMetrics(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	coll := config.MongoClient.Database("research_db").Collection("author_metrics")
+
+	if name := strings.TrimSpace(c.Query("name")); name != "" {
+		var m models.AuthorMetrics
+		err := coll.FindOne(ctx, bson.M{"_id": name}).Decode(&m)
+		if err == mongo.ErrNoDocuments {
+			// Not computed yet, e.g. right after startup; compute it now.
+			if err := utils.RefreshAuthorMetrics(ctx, []string{name}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			err = coll.FindOne(ctx, bson.M{"_id": name}).Decode(&m)
+		}
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "author not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, m)
+		return
+	}
+
+	sortField, ok := authorMetricSorts[c.DefaultQuery("sort", "h_index")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort"})
+		return
+	}
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	cur, err := coll.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: sortField, Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	authors := []models.AuthorMetrics{}
+	if err := cur.All(ctx, &authors); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sort": sortField, "authors": authors})
+}
+
+func loadAuthor(ctx context.Context, c *gin.Context, param string) (models.Author, bool) {
+	var a models.Author
+	oid, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "author not found"})
+		return a, false
+	}
+	err = config.MongoClient.Database("research_db").Collection("authors").
+		FindOne(ctx, bson.M{"_id": oid}).Decode(&a)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "author not found"})
+		return a, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return a, false
+	}
+	return a, true
+}
+
+// ListAuthors finds author identities whose name or any alias contains ?q=.
+func ListAuthors(c *gin.Context) {
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filter["aliases"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	}
+	if s := c.Query("status"); s != "" {
+		filter["status"] = s
+	}
+	cur, err := config.MongoClient.Database("research_db").Collection("authors").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	authors := []models.Author{}
+	if err := cur.All(ctx, &authors); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authors": authors})
+}
+
+func GetAuthor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	a, ok := loadAuthor(ctx, c, "id")
+	if !ok {
+		return
+	}
+	n, err := config.MongoClient.Database("research_db").Collection("papers").CountDocuments(ctx,
+		bson.M{"authors": bson.M{"$in": a.Aliases}, "deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"author": a, "papers": n})
+}
+
+// GetAuthorPapers lists the papers written under any of the author's aliases,
+// with the same filters, sorting and cursors as GET /papers.
+func GetAuthorPapers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	a, ok := loadAuthor(ctx, c, "id")
+	if !ok {
+		return
+	}
+	f, msg := parsePaperFilter(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	f.AnyAuthor = a.Aliases
+	listPapers(c, f)
+}
+
+type ClaimAuthorBody struct {
+	Note string `json:"note"`
+}
+
+// ClaimAuthor files a request by the caller to be linked to an author
+// identity. A curator has to approve it.
+func ClaimAuthor(c *gin.Context) {
+	var b ClaimAuthorBody
+	if err := c.ShouldBindJSON(&b); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(b.Note) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note too long"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	a, ok := loadAuthor(ctx, c, "id")
+	if !ok {
+		return
+	}
+	if a.UserID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "author already linked to a user"})
+		return
+	}
+
+	db := config.MongoClient.Database("research_db")
+	n, err := db.Collection("users").CountDocuments(ctx, bson.M{"_id": uid, "author_id": bson.M{"$exists": true}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if n > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "you are already linked to an author"})
+		return
+	}
+
+	claim := models.AuthorClaim{
+		AuthorID:  a.ID,
+		UserID:    uid,
+		Note:      b.Note,
+		Status:    models.ClaimPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	res, err := db.Collection("author_claims").InsertOne(ctx, claim)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "claim already pending"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Claim submitted for review", "claim_id": res.InsertedID.(primitive.ObjectID).Hex()})
+}
+
+func ListAuthorClaims(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	cur, err := config.MongoClient.Database("research_db").Collection("author_claims").Find(ctx,
+		bson.M{"status": c.DefaultQuery("status", models.ClaimPending)},
+		options.Find().SetSort(bson.M{"created_at": 1}).SetLimit(maxSearchLimit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	claims := []models.AuthorClaim{}
+	if err := cur.All(ctx, &claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"claims": claims})
+}
+
+func ApproveAuthorClaim(c *gin.Context) {
+	decideAuthorClaim(c, models.ClaimApproved)
+}
+
+func RejectAuthorClaim(c *gin.Context) {
+	decideAuthorClaim(c, models.ClaimRejected)
+}
+
+// decideAuthorClaim closes a pending claim. Approving links the author and
+// the user both ways and rejects any other claim pending on that author.
+func decideAuthorClaim(c *gin.Context, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	curator, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	claimID, err := primitive.ObjectIDFromHex(c.Param("claim_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "claim not found"})
+		return
+	}
+
+	db := config.MongoClient.Database("research_db")
+	now := time.Now().UTC()
+	var claim models.AuthorClaim
+	err = db.Collection("author_claims").FindOneAndUpdate(ctx,
+		bson.M{"_id": claimID, "status": models.ClaimPending},
+		bson.M{"$set": bson.M{"status": status, "decided_at": now, "decided_by": curator}},
+	).Decode(&claim)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pending claim with that id"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	if status == models.ClaimApproved {
+		res, err := db.Collection("authors").UpdateOne(ctx,
+			bson.M{"_id": claim.AuthorID, "user_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"user_id": claim.UserID, "status": models.AuthorConfirmed, "updated_at": now}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		if res.MatchedCount == 0 {
+			_, _ = db.Collection("author_claims").UpdateByID(ctx, claimID,
+				bson.M{"$set": bson.M{"status": models.ClaimPending}, "$unset": bson.M{"decided_at": "", "decided_by": ""}})
+			c.JSON(http.StatusConflict, gin.H{"error": "author already linked to a user"})
+			return
+		}
+		if _, err := db.Collection("users").UpdateByID(ctx, claim.UserID,
+			bson.M{"$set": bson.M{"author_id": claim.AuthorID}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		_, _ = db.Collection("author_claims").UpdateMany(ctx,
+			bson.M{"author_id": claim.AuthorID, "status": models.ClaimPending},
+			bson.M{"$set": bson.M{"status": models.ClaimRejected, "decided_at": now, "decided_by": curator}})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Claim " + status, "claim_id": claimID.Hex()})
+}
+
+type MergeAuthorsBody struct {
+	SourceID string `json:"source_id"`
+}
+
+// MergeAuthors folds the source author into :id. The source's aliases move
+// over and the source record is removed; a user linked to the source stays
+// linked through the merged author.
+func MergeAuthors(c *gin.Context) {
+	var b MergeAuthorsBody
+	if err := c.BindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	srcID, err := primitive.ObjectIDFromHex(b.SourceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid source_id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	target, ok := loadAuthor(ctx, c, "id")
+	if !ok {
+		return
+	}
+	if srcID == target.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot merge an author into itself"})
+		return
+	}
+
+	db := config.MongoClient.Database("research_db")
+	var src models.Author
+	if err := db.Collection("authors").FindOne(ctx, bson.M{"_id": srcID}).Decode(&src); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "source author not found"})
+		return
+	}
+	if src.UserID != nil && target.UserID != nil && *src.UserID != *target.UserID {
+		c.JSON(http.StatusConflict, gin.H{"error": "both authors are linked to different users"})
+		return
+	}
+
+	set := bson.M{"updated_at": time.Now().UTC()}
+	if target.UserID == nil && src.UserID != nil {
+		set["user_id"] = *src.UserID
+		set["status"] = models.AuthorConfirmed
+	}
+	if _, err := db.Collection("authors").UpdateByID(ctx, target.ID, bson.M{
+		"$addToSet": bson.M{"aliases": bson.M{"$each": src.Aliases}},
+		"$set":      set,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if src.UserID != nil {
+		_, _ = db.Collection("users").UpdateByID(ctx, *src.UserID, bson.M{"$set": bson.M{"author_id": target.ID}})
+	}
+	_, _ = db.Collection("author_claims").UpdateMany(ctx,
+		bson.M{"author_id": src.ID}, bson.M{"$set": bson.M{"author_id": target.ID}})
+	if _, err := db.Collection("authors").DeleteOne(ctx, bson.M{"_id": src.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authors merged", "author_id": target.ID.Hex()})
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+type PaperSummary struct {
+	ID                primitive.ObjectID `json:"id"`
+	Title             string             `json:"title"`
+	Authors           []string           `json:"authors"`
+	PublicationDate   time.Time          `json:"publication_date"`
+	JournalConference string             `json:"journal_conference"`
+}
+
+func summaryOf(p models.Paper) PaperSummary {
+	return PaperSummary{
+		ID:                p.ID,
+		Title:             p.Title,
+		Authors:           p.Authors,
+		PublicationDate:   p.PublicationDate,
+		JournalConference: p.JournalConference,
+	}
+}
+
+// citationNeighbourPipeline walks the citation edges of a paper and returns
+// the live papers on the other end. Outgoing edges (references) go from
+// paper_id to cited_paper_id; incoming ones (cited-by) the other way round,
+// skipping edges whose citing paper is in the trash.
+func citationNeighbourPipeline(oid primitive.ObjectID, outgoing bool) []bson.M {
+	match := bson.M{"paper_id": oid}
+	other := "cited_paper_id"
+	if !outgoing {
+		match = bson.M{"cited_paper_id": oid, "source_deleted": bson.M{"$ne": true}}
+		other = "paper_id"
+	}
+	return []bson.M{
+		{"$match": match},
+		{"$lookup": bson.M{
+			"from":         "papers",
+			"localField":   other,
+			"foreignField": "_id",
+			"as":           "paper",
+		}},
+		{"$unwind": "$paper"},
+		{"$replaceRoot": bson.M{"newRoot": "$paper"}},
+		{"$match": bson.M{"deleted_at": bson.M{"$exists": false}}},
+	}
+}
+
+func fetchReferenceSummaries(ctx context.Context, oid primitive.ObjectID) ([]PaperSummary, error) {
+	pipeline := append(citationNeighbourPipeline(oid, true),
+		bson.M{"$sort": bson.D{{Key: "publication_date", Value: -1}, {Key: "_id", Value: -1}}})
+	cur, err := config.MongoClient.Database("research_db").Collection("citations").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var papers []models.Paper
+	if err := cur.All(ctx, &papers); err != nil {
+		return nil, err
+	}
+	out := make([]PaperSummary, 0, len(papers))
+	for _, p := range papers {
+		out = append(out, summaryOf(p))
+	}
+	return out, nil
+}
+
+func GetPaperReferences(c *gin.Context) {
+	listCitationNeighbours(c, true)
+}
+
+func GetPaperCitedBy(c *gin.Context) {
+	listCitationNeighbours(c, false)
+}
+
+func listCitationNeighbours(c *gin.Context, outgoing bool) {
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	page, msg := parsePaperPage(c, paperFilter{})
+	if msg == "" && page.Sort == "citation_count" {
+		msg = "invalid sort"
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	n, err := config.MongoClient.Database("research_db").Collection("papers").
+		CountDocuments(ctx, bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	pipeline := citationNeighbourPipeline(oid, outgoing)
+	if page.Cursor != nil {
+		pipeline = append(pipeline, bson.M{"$match": page.Cursor.match(paperSortFields[page.Sort])})
+	}
+	pipeline = append(pipeline, page.sortStage(), bson.M{"$limit": page.Limit + 1})
+
+	cur, err := config.MongoClient.Database("research_db").Collection("citations").Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var papers []PaperSearchResult
+	if err := cur.All(ctx, &papers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	var next interface{}
+	if len(papers) > page.Limit {
+		papers = papers[:page.Limit]
+		next = page.cursorFor(papers[len(papers)-1])
+	}
+	out := make([]PaperSummary, 0, len(papers))
+	for _, p := range papers {
+		out = append(out, summaryOf(p.Paper))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"paper_id":    oid.Hex(),
+		"sort":        page.Sort,
+		"count":       len(out),
+		"papers":      out,
+		"next_cursor": next,
+	})
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pageCursor is the decoded form of the opaque cursor handed out by paper
+// listings. It pins the sort it was issued for and the position of the last
+// returned document, using _id as the tiebreaker so that inserts between
+// requests never shift or repeat a page.
+type pageCursor struct {
+	Sort  string             `bson:"s"`
+	Desc  bool               `bson:"d"`
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func encodeCursor(pc pageCursor) string {
+	raw, err := bson.Marshal(pc)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var pc pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pc, errInvalidCursor
+	}
+	if err := bson.Unmarshal(raw, &pc); err != nil || pc.ID.IsZero() {
+		return pc, errInvalidCursor
+	}
+	return pc, nil
+}
+
+// match returns the filter selecting documents strictly after the cursor
+// position for the given sort field.
+func (pc pageCursor) match(field string) bson.M {
+	op := "$gt"
+	if pc.Desc {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: pc.Value}},
+		bson.M{field: pc.Value, "_id": bson.M{op: pc.ID}},
+	}}
+}
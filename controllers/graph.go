@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+const (
+	defaultGraphDepth = 3
+	maxGraphDepth     = 6
+)
+
+// graphEdge is a citation edge: From cites To.
+type graphEdge struct {
+	From  primitive.ObjectID `bson:"paper_id" json:"from"`
+	To    primitive.ObjectID `bson:"cited_paper_id" json:"to"`
+	Depth int                `bson:"depth" json:"-"`
+}
+
+type GraphNode struct {
+	PaperSummary
+	Depth int `json:"depth"`
+}
+
+func parseGraphDepth(c *gin.Context, key string) (int, bool) {
+	s := c.Query(key)
+	if s == "" {
+		return defaultGraphDepth, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxGraphDepth {
+		return 0, false
+	}
+	return n, true
+}
+
+// citationEdges returns every citation edge reachable from root within depth
+// hops. With outgoing set it follows references (root cites ...), otherwise
+// it follows incoming citations (... cites root). $graphLookup remembers the
+// edges it has already visited, so cycles in the citation data terminate.
+// Edges out of trashed papers are never followed.
+func citationEdges(ctx context.Context, root primitive.ObjectID, outgoing bool, depth int) ([]graphEdge, error) {
+	from, to := "cited_paper_id", "paper_id"
+	if !outgoing {
+		from, to = "paper_id", "cited_paper_id"
+	}
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": root}},
+		{"$graphLookup": bson.M{
+			"from":                    "citations",
+			"startWith":               "$_id",
+			"connectFromField":        from,
+			"connectToField":          to,
+			"as":                      "edges",
+			"maxDepth":                depth - 1,
+			"depthField":              "depth",
+			"restrictSearchWithMatch": bson.M{"source_deleted": bson.M{"$ne": true}},
+		}},
+		{"$project": bson.M{"edges": 1}},
+	}
+	cur, err := config.MongoClient.Database("research_db").Collection("papers").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var out []struct {
+		Edges []graphEdge `bson:"edges"`
+	}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Edges, nil
+}
+
+// hopDistances maps each paper reached through edges to the smallest number
+// of hops from the root. An edge found at graph depth d sits between hop d
+// and hop d+1 in the direction of travel.
+func hopDistances(root primitive.ObjectID, edges []graphEdge, outgoing bool, dist map[primitive.ObjectID]int) {
+	dist[root] = 0
+	for _, e := range edges {
+		far := e.To
+		if !outgoing {
+			far = e.From
+		}
+		if d, ok := dist[far]; !ok || e.Depth+1 < d {
+			dist[far] = e.Depth + 1
+		}
+	}
+}
+
+func loadSummaries(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]PaperSummary, error) {
+	cur, err := config.MongoClient.Database("research_db").Collection("papers").Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	var papers []models.Paper
+	if err := cur.All(ctx, &papers); err != nil {
+		return nil, err
+	}
+	out := make(map[primitive.ObjectID]PaperSummary, len(papers))
+	for _, p := range papers {
+		out[p.ID] = summaryOf(p)
+	}
+	return out, nil
+}
+
+// buildGraph turns hop distances and edges into the node and edge lists
+// returned to clients, dropping anything that touches a missing or trashed
+// paper.
+func buildGraph(ctx context.Context, dist map[primitive.ObjectID]int, edges []graphEdge) ([]GraphNode, []graphEdge, error) {
+	ids := make([]primitive.ObjectID, 0, len(dist))
+	for id := range dist {
+		ids = append(ids, id)
+	}
+	summaries, err := loadSummaries(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := make([]GraphNode, 0, len(summaries))
+	for id, s := range summaries {
+		nodes = append(nodes, GraphNode{PaperSummary: s, Depth: dist[id]})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].PublicationDate.After(nodes[j].PublicationDate)
+	})
+
+	seen := map[[2]primitive.ObjectID]bool{}
+	kept := make([]graphEdge, 0, len(edges))
+	for _, e := range edges {
+		_, okFrom := summaries[e.From]
+		_, okTo := summaries[e.To]
+		key := [2]primitive.ObjectID{e.From, e.To}
+		if okFrom && okTo && !seen[key] {
+			seen[key] = true
+			kept = append(kept, e)
+		}
+	}
+	return nodes, kept, nil
+}
+
+func rootParam(ctx context.Context, c *gin.Context, name string) (primitive.ObjectID, bool) {
+	oid, err := primitive.ObjectIDFromHex(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return oid, false
+	}
+	n, err := config.MongoClient.Database("research_db").Collection("papers").
+		CountDocuments(ctx, bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return oid, false
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return oid, false
+	}
+	return oid, true
+}
+
+// GetPaperAncestors lists the papers the given paper builds on, directly or
+// through up to ?depth= hops of references.
+func GetPaperAncestors(c *gin.Context) {
+	listLineage(c, true)
+}
+
+// GetPaperDescendants lists the papers that cite the given paper, directly
+// or through up to ?depth= hops of citations.
+func GetPaperDescendants(c *gin.Context) {
+	listLineage(c, false)
+}
+
+func listLineage(c *gin.Context, outgoing bool) {
+	depth, ok := parseGraphDepth(c, "depth")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid depth"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	root, ok := rootParam(ctx, c, "id")
+	if !ok {
+		return
+	}
+	edges, err := citationEdges(ctx, root, outgoing, depth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	dist := map[primitive.ObjectID]int{}
+	hopDistances(root, edges, outgoing, dist)
+	delete(dist, root)
+
+	nodes, _, err := buildGraph(ctx, dist, edges)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"paper_id": root.Hex(), "depth": depth, "count": len(nodes), "papers": nodes})
+}
+
+// GetCitationGraph exports the subgraph around a paper as nodes and edges.
+// ?direction= is ancestors, descendants or both (the default).
+func GetCitationGraph(c *gin.Context) {
+	depth, ok := parseGraphDepth(c, "depth")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid depth"})
+		return
+	}
+	direction := c.DefaultQuery("direction", "both")
+	if direction != "ancestors" && direction != "descendants" && direction != "both" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid direction"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	root, ok := rootParam(ctx, c, "id")
+	if !ok {
+		return
+	}
+
+	var edges []graphEdge
+	dist := map[primitive.ObjectID]int{}
+	for _, outgoing := range []bool{true, false} {
+		if (outgoing && direction == "descendants") || (!outgoing && direction == "ancestors") {
+			continue
+		}
+		e, err := citationEdges(ctx, root, outgoing, depth)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		hopDistances(root, e, outgoing, dist)
+		edges = append(edges, e...)
+	}
+
+	nodes, edges, err := buildGraph(ctx, dist, edges)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"root":      root.Hex(),
+		"direction": direction,
+		"depth":     depth,
+		"nodes":     nodes,
+		"edges":     edges,
+	})
+}
+
+// GetCitationPath finds the shortest chain of references leading from :id to
+// :target. If :id does not reach :target, the reverse chain is tried and the
+// response says which way the path runs.
+func GetCitationPath(c *gin.Context) {
+	depth, ok := parseGraphDepth(c, "max_depth")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid max_depth"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	src, ok := rootParam(ctx, c, "id")
+	if !ok {
+		return
+	}
+	dst, ok := rootParam(ctx, c, "target")
+	if !ok {
+		return
+	}
+
+	for _, pair := range [][2]primitive.ObjectID{{src, dst}, {dst, src}} {
+		edges, err := citationEdges(ctx, pair[0], true, depth)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		path := shortestPath(pair[0], pair[1], edges)
+		if path == nil {
+			continue
+		}
+
+		summaries, err := loadSummaries(ctx, path)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		papers := make([]PaperSummary, 0, len(path))
+		for _, id := range path {
+			papers = append(papers, summaries[id])
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":   pair[0].Hex(),
+			"to":     pair[1].Hex(),
+			"length": len(path) - 1,
+			"path":   papers,
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "no citation path within max_depth"})
+}
+
+// shortestPath runs a breadth-first search over the edges and returns the
+// node sequence from src to dst, or nil if dst is unreachable.
+func shortestPath(src, dst primitive.ObjectID, edges []graphEdge) []primitive.ObjectID {
+	if src == dst {
+		return []primitive.ObjectID{src}
+	}
+	adj := map[primitive.ObjectID][]primitive.ObjectID{}
+	for _, e := range edges {
+		adj[e.From] = append(adj[e.From], e.To)
+	}
+
+	prev := map[primitive.ObjectID]primitive.ObjectID{src: src}
+	queue := []primitive.ObjectID{src}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range adj[cur] {
+			if _, seen := prev[next]; seen {
+				continue
+			}
+			prev[next] = cur
+			if next == dst {
+				path := []primitive.ObjectID{dst}
+				for at := cur; at != src; at = prev[at] {
+					path = append(path, at)
+				}
+				path = append(path, src)
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/scheduler"
+	"DB_HW5/utils"
+)
+
+type JobStatus struct {
+	Name     string         `json:"name"`
+	Schedule string         `json:"schedule"`
+	Timeout  string         `json:"timeout"`
+	Running  bool           `json:"running"`
+	NextRun  time.Time      `json:"next_run"`
+	LastRun  *models.JobRun `json:"last_run,omitempty"`
+}
+
+// ListJobs describes every background job with its latest run, and which
+// instance currently holds the scheduler lease.
+func ListJobs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	leader, err := config.Redis.Get(ctx, utils.SchedulerLeaderKey).Result()
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+
+	out := []JobStatus{}
+	for _, j := range scheduler.Jobs() {
+		s := JobStatus{Name: j.Name, Schedule: j.Schedule, Timeout: j.Timeout.String()}
+		n, err := config.Redis.Exists(ctx, utils.JobLockKey(j.Name)).Result()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+			return
+		}
+		s.Running = n > 0
+		last, err := scheduler.LastRun(ctx, j.Name)
+		switch err {
+		case nil:
+			s.LastRun = &last
+			s.NextRun = j.NextRun(last.StartedAt)
+		case mongo.ErrNoDocuments:
+			s.NextRun = j.NextRun(time.Time{})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		out = append(out, s)
+	}
+	c.JSON(http.StatusOK, gin.H{"leader": leader, "jobs": out})
+}
+
+// ListJobRuns returns the newest runs of job :name.
+func ListJobRuns(c *gin.Context) {
+	name := c.Param("name")
+	if !knownJob(name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	cur, err := config.MongoClient.Database("research_db").Collection("job_runs").Find(ctx,
+		bson.M{"job": name}, options.Find().SetSort(bson.M{"started_at": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	runs := []models.JobRun{}
+	if err := cur.All(ctx, &runs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": name, "runs": runs})
+}
+
+// RunJob starts job :name right away on this instance, unless a run of it
+// is already in progress anywhere.
+func RunJob(c *gin.Context) {
+	actor, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	run, err := scheduler.Trigger(c.Param("name"), actor)
+	switch err {
+	case nil:
+	case scheduler.ErrUnknownJob:
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	case scheduler.ErrJobRunning:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case scheduler.ErrShuttingDown:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	utils.Audit(ctx, models.AuditEvent{Action: models.AuditJobTriggered, ActorID: &actor, IP: c.ClientIP(),
+		Details: map[string]any{"job": run.Job, "run_id": run.ID.Hex()}})
+	c.JSON(http.StatusAccepted, gin.H{"message": "Job started", "run": run})
+}
+
+func knownJob(name string) bool {
+	for _, j := range scheduler.Jobs() {
+		if j.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+type MergePapersBody struct {
+	SourceID string `json:"source_id"`
+}
+
+// MergePapers folds a duplicate paper into the one named by :id. Citations
+// to and from the duplicate move over to the target, dropping any that would
+// become self-citations or repeat an existing edge, its views and viewers
+// are added to the target, and the duplicate goes to the trash marked as
+// merged.
+func MergePapers(c *gin.Context) {
+	var b MergePapersBody
+	if err := c.BindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	srcID, err := primitive.ObjectIDFromHex(b.SourceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid source_id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	target, ok := loadEditablePaper(ctx, c, false)
+	if !ok {
+		return
+	}
+	if srcID == target.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot merge a paper into itself"})
+		return
+	}
+
+	db := config.MongoClient.Database("research_db")
+	var src models.Paper
+	if err := db.Collection("papers").FindOne(ctx,
+		bson.M{"_id": srcID, "deleted_at": bson.M{"$exists": false}}).Decode(&src); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "source paper not found"})
+		return
+	}
+	// Flush the source's views, including any claim left pending, into
+	// Mongo first; a claim still pending once it is merged would later be
+	// applied to the trashed source instead of the target.
+	if _, err := utils.SyncViews(ctx, srcID.Hex()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "views sync error"})
+		return
+	}
+
+	cur, err := db.Collection("citations").Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"paper_id": bson.M{"$in": bson.A{srcID, target.ID}}},
+		bson.M{"cited_paper_id": bson.M{"$in": bson.A{srcID, target.ID}}},
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var edges []models.Citation
+	if err := cur.All(ctx, &edges); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	// Edges the target already has, keyed by the paper on the other end.
+	cites := map[primitive.ObjectID]bool{}
+	citedBy := map[primitive.ObjectID]bool{}
+	for _, e := range edges {
+		if e.PaperID == target.ID {
+			cites[e.CitedPaperID] = true
+		}
+		if e.CitedPaperID == target.ID {
+			citedBy[e.PaperID] = true
+		}
+	}
+
+	var drop, moveOut, moveIn []primitive.ObjectID
+	for _, e := range edges {
+		switch {
+		case e.PaperID == srcID && e.CitedPaperID == target.ID,
+			e.CitedPaperID == srcID && e.PaperID == target.ID:
+			drop = append(drop, e.ID)
+		case e.PaperID == srcID:
+			if cites[e.CitedPaperID] {
+				drop = append(drop, e.ID)
+			} else {
+				cites[e.CitedPaperID] = true
+				moveOut = append(moveOut, e.ID)
+			}
+		case e.CitedPaperID == srcID:
+			if citedBy[e.PaperID] {
+				drop = append(drop, e.ID)
+			} else {
+				citedBy[e.PaperID] = true
+				moveIn = append(moveIn, e.ID)
+			}
+		}
+	}
+
+	citations := db.Collection("citations")
+	if len(moveOut) > 0 {
+		if _, err := citations.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": moveOut}},
+			bson.M{"$set": bson.M{"paper_id": target.ID}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "citation update error"})
+			return
+		}
+	}
+	if len(moveIn) > 0 {
+		if _, err := citations.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": moveIn}},
+			bson.M{"$set": bson.M{"cited_paper_id": target.ID}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "citation update error"})
+			return
+		}
+	}
+	if len(drop) > 0 {
+		if _, err := citations.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": drop}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "citation update error"})
+			return
+		}
+	}
+
+	// The source's views are read and zeroed in the same update that
+	// retires it, so views a sync adds in between are not lost.
+	uid, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	now := time.Now().UTC()
+	papers := db.Collection("papers")
+	var retired models.Paper
+	if err := papers.FindOneAndUpdate(ctx, bson.M{"_id": srcID}, bson.M{"$set": bson.M{
+		"deleted_at":  now,
+		"deleted_by":  uid,
+		"merged_into": target.ID,
+		"views":       0,
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&retired); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	views := retired.Views
+	// Views recorded, or claimed by a running sync, before the source went
+	// to the trash can still land on it; drain once more and take those too.
+	if _, err := utils.SyncViews(ctx, srcID.Hex()); err == nil {
+		var late models.Paper
+		if err := papers.FindOneAndUpdate(ctx, bson.M{"_id": srcID},
+			bson.M{"$set": bson.M{"views": 0}},
+			options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&late); err == nil {
+			views += late.Views
+		}
+	}
+	if _, err := papers.UpdateByID(ctx, target.ID, bson.M{"$inc": bson.M{"views": views}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if err := config.Redis.PFMerge(ctx, utils.PaperViewersKey(target.ID.Hex()),
+		utils.PaperViewersKey(target.ID.Hex()), utils.PaperViewersKey(srcID.Hex())).Err(); err == nil {
+		_ = config.Redis.SAdd(ctx, utils.PaperViewersDirtyKey, target.ID.Hex()).Err()
+	}
+	_ = utils.MoveTrending(ctx, srcID.Hex(), target.ID.Hex())
+
+	refreshMetricsAround(ctx, target.ID, append(target.Authors, src.Authors...))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Papers merged",
+		"paper_id":          target.ID.Hex(),
+		"citations_moved":   len(moveOut) + len(moveIn),
+		"citations_dropped": len(drop),
+		"views_moved":       views,
+	})
+}
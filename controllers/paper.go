@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"DB_HW5/config"
 	"DB_HW5/models"
@@ -25,12 +26,7 @@ type UploadPaperBody struct {
 }
 
 func PostPaper(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing X-User-ID"})
-		return
-	}
-	uid, err := primitive.ObjectIDFromHex(userID)
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
 		return
@@ -40,8 +36,8 @@ func PostPaper(c *gin.Context) {
 	defer cancel()
 
 	userCountCmd := bson.D{
-		{"count", "users"},
-		{"query", bson.M{"_id": uid}},
+		{Key: "count", Value: "users"},
+		{Key: "query", Value: bson.M{"_id": uid}},
 	}
 	var userCountRes bson.M
 	if err := config.MongoClient.Database("research_db").RunCommand(ctx, userCountCmd).Decode(&userCountRes); err != nil {
@@ -61,34 +57,61 @@ func PostPaper(c *gin.Context) {
 	}
 
 
-	if !(len(b.Title) > 0 && len(b.Title) <= 200) ||
-		!(len(b.Abstract) > 0 && len(b.Abstract) <= 1000) ||
-		len(b.Authors) < 1 || len(b.Authors) > 5 ||
-		len(b.Keywords) < 1 || len(b.Keywords) > 5 ||
-		len(b.JournalConference) <= 0 || len(b.JournalConference) > 200 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fields"})
+	if msg := validatePaperFields(b.Title, b.Abstract, b.Authors, b.Keywords, b.JournalConference); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
-	for _, a := range b.Authors {
-		if len(a) == 0 || len(a) > 100 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid author"})
+	pubTime, err := time.Parse("2006-01-02", b.PublicationDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid publication_date"})
+		return
+	}
+
+
+	// The ID is chosen here so that citations can be checked against it
+	// and the revision and citations can refer to it without reading the
+	// paper back.
+	paperID := primitive.NewObjectID()
+
+	if len(b.Citations) > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max 5 citations"})
+		return
+	}
+	var citationDocs []interface{}
+	var cited []string
+	for _, cid := range b.Citations {
+		oid, err := primitive.ObjectIDFromHex(cid)
+		if err != nil || oid == paperID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid citation id"})
 			return
 		}
-	}
-	for _, k := range b.Keywords {
-		if len(k) == 0 || len(k) > 50 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid keyword"})
+
+	
+		countCmd := bson.D{
+			{Key: "count", Value: "papers"},
+			{Key: "query", Value: bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}}},
+		}
+		var cntRes bson.M
+		if err := config.MongoClient.Database("research_db").RunCommand(ctx, countCmd).Decode(&cntRes); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid citation id"})
 			return
 		}
-	}
-	pubTime, err := time.Parse("2006-02-01", b.PublicationDate)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid publication_date"})
-		return
+		if cntRes["n"].(int32) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid citation id"})
+			return
+		}
+
+		citation := models.Citation{
+			PaperID:      paperID,
+			CitedPaperID: oid,
+		}
+		citationDocs = append(citationDocs, citation)
+		cited = append(cited, oid.Hex())
 	}
 
 
 	paper := models.Paper{
+		ID:                paperID,
 		Title:             b.Title,
 		Authors:           b.Authors,
 		Abstract:          b.Abstract,
@@ -97,69 +120,39 @@ func PostPaper(c *gin.Context) {
 		Keywords:          b.Keywords,
 		UploadedBy:        uid,
 		Views:             0,
+		Revision:          1,
 	}
 
 
-	insertCmd := bson.D{{"insert", "papers"}, {"documents", []interface{}{paper}}}
+	insertCmd := bson.D{{Key: "insert", Value: "papers"}, {Key: "documents", Value: []interface{}{paper}}}
 	var insertRes bson.M
 	if err := config.MongoClient.Database("research_db").RunCommand(ctx, insertCmd).Decode(&insertRes); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
 
+	_ = insertRevision(ctx, models.PaperRevision{
+		PaperID:  paperID,
+		Rev:      1,
+		EditedBy: uid,
+		EditedAt: time.Now().UTC(),
+		Changed:  []string{"title", "authors", "abstract", "publication_date", "journal_conference", "keywords"},
+		Snapshot: snapshotOf(paper),
+	})
 
-	var insertedDoc models.Paper
-	_ = config.MongoClient.Database("research_db").
-		Collection("papers").
-		FindOne(ctx, bson.M{"title": paper.Title, "uploaded_by": uid}).
-		Decode(&insertedDoc)
-	paperID := insertedDoc.ID
-
-
-	if len(b.Citations) > 5 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "max 5 citations"})
-		return
-	}
-	if len(b.Citations) > 0 {
-		var citationDocs []interface{}
-		for _, cid := range b.Citations {
-			oid, err := primitive.ObjectIDFromHex(cid)
-			if err != nil || oid == paperID {
-				c.JSON(http.StatusNotFound, gin.H{"error": "invalid citation id"})
-				return
-			}
-
-	
-			countCmd := bson.D{
-				{"count", "papers"},
-				{"query", bson.M{"_id": oid}},
-			}
-			var cntRes bson.M
-			if err := config.MongoClient.Database("research_db").RunCommand(ctx, countCmd).Decode(&cntRes); err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "invalid citation id"})
-				return
-			}
-			if cntRes["n"].(int32) == 0 {
-				c.JSON(http.StatusNotFound, gin.H{"error": "invalid citation id"})
-				return
-			}
-
-			citation := models.Citation{
-				PaperID:      paperID,
-				CitedPaperID: oid,
-			}
-			citationDocs = append(citationDocs, citation)
-		}
-		if len(citationDocs) > 0 {
-			insertCitCmd := bson.D{{"insert", "citations"}, {"documents", citationDocs}}
-			var citRes bson.M
-			if err := config.MongoClient.Database("research_db").RunCommand(ctx, insertCitCmd).Decode(&citRes); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "citation insert error"})
-				return
-			}
+	if len(citationDocs) > 0 {
+		insertCitCmd := bson.D{{Key: "insert", Value: "citations"}, {Key: "documents", Value: citationDocs}}
+		var citRes bson.M
+		if err := config.MongoClient.Database("research_db").RunCommand(ctx, insertCitCmd).Decode(&citRes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "citation insert error"})
+			return
 		}
+		_ = utils.BumpTrending(ctx, utils.TrendingCitationWeight, cited...)
 	}
 
+	refreshMetricsAround(ctx, paperID, b.Authors)
+	utils.LinkAuthorsAsync(b.Authors)
+
 	c.JSON(http.StatusCreated, gin.H{"message": "Paper uploaded", "paper_id": paperID.Hex()})
 }
 
@@ -176,9 +169,9 @@ func GetPaperDetails(c *gin.Context) {
 
 
 	findCmd := bson.D{
-		{"find", "papers"},
-		{"filter", bson.M{"_id": oid}},
-		{"limit", 1},
+		{Key: "find", Value: "papers"},
+		{Key: "filter", Value: bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}}},
+		{Key: "limit", Value: 1},
 	}
 	var findRes bson.M
 	if err := config.MongoClient.Database("research_db").RunCommand(ctx, findCmd).Decode(&findRes); err != nil {
@@ -195,8 +188,8 @@ func GetPaperDetails(c *gin.Context) {
 
 	
 	countCitCmd := bson.D{
-		{"count", "citations"},
-		{"query", bson.M{"cited_paper_id": oid}},
+		{Key: "count", Value: "citations"},
+		{Key: "query", Value: bson.M{"cited_paper_id": oid, "source_deleted": bson.M{"$ne": true}}},
 	}
 	var citCountRes bson.M
 	_ = config.MongoClient.Database("research_db").RunCommand(ctx, countCitCmd).Decode(&citCountRes)
@@ -206,11 +199,19 @@ func GetPaperDetails(c *gin.Context) {
 	}
 
 
-	viewsKey := utils.PaperViewsKey(id)
-	_ = config.Redis.Incr(ctx, viewsKey).Err()
-	curViews, _ := config.Redis.Get(ctx, viewsKey).Int64()
+	pagerank, _ := paperDoc["pagerank"].(float64)
 
-	c.JSON(http.StatusOK, gin.H{
+	// Mongo holds the synced total; Redis holds what has not reached it yet.
+	if !utils.IsBotUserAgent(c.Request.UserAgent()) {
+		_ = utils.RecordView(ctx, id, viewerID(c))
+	}
+	syncToken, _ := paperDoc["view_sync_token"].(string)
+	curViews, _ := utils.UnsyncedViews(ctx, id, syncToken)
+	curViews += docInt64(paperDoc["views"])
+	uniqueViewers, _ := utils.UniqueViewers(ctx, id)
+	uniqueViewers = max(uniqueViewers, docInt64(paperDoc["unique_viewers"]))
+
+	resp := gin.H{
 		"id":                 paperDoc["_id"].(primitive.ObjectID).Hex(),
 		"title":              paperDoc["title"],
 		"authors":            paperDoc["authors"],
@@ -220,5 +221,220 @@ func GetPaperDetails(c *gin.Context) {
 		"keywords":           paperDoc["keywords"],
 		"citation_count":     citCnt,
 		"views":              curViews,
+		"unique_viewers":     uniqueViewers,
+		"pagerank":           pagerank,
+	}
+
+	if c.Query("include") == "references" {
+		refs, err := fetchReferenceSummaries(ctx, oid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		resp["references"] = refs
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// viewerID identifies a viewer for unique counts: the user if known,
+// otherwise a hash of the client IP.
+func viewerID(c *gin.Context) string {
+	if uid := c.GetString("user_id"); uid != "" {
+		return "user:" + uid
+	}
+	return "ip:" + utils.TokenHash(c.ClientIP())
+}
+
+// docInt64 reads a number from a raw bson.M, whichever integer type the
+// driver decoded it as.
+func docInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return 0
+}
+
+func validatePaperFields(title, abstract string, authors, keywords []string, venue string) string {
+	if !(len(title) > 0 && len(title) <= 200) ||
+		!(len(abstract) > 0 && len(abstract) <= 1000) ||
+		len(authors) < 1 || len(authors) > 5 ||
+		len(keywords) < 1 || len(keywords) > 5 ||
+		len(venue) <= 0 || len(venue) > 200 {
+		return "invalid fields"
+	}
+	for _, a := range authors {
+		if len(a) == 0 || len(a) > 100 {
+			return "invalid author"
+		}
+	}
+	for _, k := range keywords {
+		if len(k) == 0 || len(k) > 50 {
+			return "invalid keyword"
+		}
+	}
+	return ""
+}
+
+type UpdatePaperBody struct {
+	Title             *string   `json:"title"`
+	Authors           *[]string `json:"authors"`
+	Abstract          *string   `json:"abstract"`
+	PublicationDate   *string   `json:"publication_date"`
+	JournalConference *string   `json:"journal_conference"`
+	Keywords          *[]string `json:"keywords"`
+}
+
+// loadEditablePaper fetches the paper named by the :id param and checks that
+// the caller uploaded it or is a curator. With trashed set it looks in the
+// trash instead of at live papers. It writes the error response itself.
+func loadEditablePaper(ctx context.Context, c *gin.Context, trashed bool) (models.Paper, bool) {
+	var paper models.Paper
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return paper, false
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return paper, false
+	}
+
+	if err := config.MongoClient.Database("research_db").Collection("papers").
+		FindOne(ctx, bson.M{"_id": oid, "deleted_at": bson.M{"$exists": trashed}}).Decode(&paper); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		}
+		return paper, false
+	}
+
+	if paper.UploadedBy != uid && !hasPermission(ctx, c, PermCuratePapers) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the uploader or a curator can modify this paper"})
+		return paper, false
+	}
+	return paper, true
+}
+
+// UpdatePaper (PATCH) changes only the fields present in the body.
+func UpdatePaper(c *gin.Context) {
+	editPaper(c, false)
+}
+
+// ReplacePaper (PUT) replaces every editable field, so the body must carry
+// all of them.
+func ReplacePaper(c *gin.Context) {
+	editPaper(c, true)
+}
+
+func editPaper(c *gin.Context, replace bool) {
+	var b UpdatePaperBody
+	if err := c.BindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if replace && (b.Title == nil || b.Authors == nil || b.Abstract == nil ||
+		b.PublicationDate == nil || b.JournalConference == nil || b.Keywords == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PUT requires title, authors, abstract, publication_date, journal_conference and keywords"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	paper, ok := loadEditablePaper(ctx, c, false)
+	if !ok {
+		return
+	}
+
+	next := snapshotOf(paper)
+	if b.Title != nil {
+		next.Title = *b.Title
+	}
+	if b.Authors != nil {
+		next.Authors = *b.Authors
+	}
+	if b.Abstract != nil {
+		next.Abstract = *b.Abstract
+	}
+	if b.JournalConference != nil {
+		next.JournalConference = *b.JournalConference
+	}
+	if b.Keywords != nil {
+		next.Keywords = *b.Keywords
+	}
+	if b.PublicationDate != nil {
+		pubTime, err := time.Parse("2006-01-02", *b.PublicationDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid publication_date"})
+			return
+		}
+		next.PublicationDate = pubTime
+	}
+	if msg := validatePaperFields(next.Title, next.Abstract, next.Authors, next.Keywords, next.JournalConference); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	editor, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	updated, changed, err := applyPaperEdit(ctx, paper, next, editor, nil)
+	if err == errEditConflict {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Paper updated", "changed": changed, "paper": updated})
+}
+
+// DeletePaper moves a paper to the trash. Its outgoing citations are flagged
+// rather than removed so that RestorePaper can bring everything back; the
+// purge job deletes them once the retention window has passed.
+func DeletePaper(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	paper, ok := loadEditablePaper(ctx, c, false)
+	if !ok {
+		return
+	}
+	uid, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	now := time.Now().UTC()
+
+	db := config.MongoClient.Database("research_db")
+	res, err := db.Collection("papers").UpdateOne(ctx,
+		bson.M{"_id": paper.ID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deleted_at": now, "deleted_by": uid}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if _, err := db.Collection("citations").UpdateMany(ctx,
+		bson.M{"paper_id": paper.ID},
+		bson.M{"$set": bson.M{"source_deleted": true}},
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "citation update error"})
+		return
+	}
+	_ = utils.RemoveTrending(ctx, paper.ID.Hex())
+	refreshMetricsAround(ctx, paper.ID, paper.Authors)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Paper moved to trash",
+		"paper_id": paper.ID.Hex(),
+		"purge_at": now.Add(config.Cfg.PaperRetention),
 	})
 }
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"DB_HW5/config"
+	"DB_HW5/utils"
+)
+
+// Rate limit buckets. Each caller has a separate quota per bucket.
+const (
+	BucketAPI    = "api"
+	BucketSearch = "search"
+	BucketCreate = "create"
+	BucketPublic = "public"
+	// BucketIP counts every request to an authenticated route per client
+	// IP before credentials are checked, so guessing tokens or API keys is
+	// throttled too.
+	BucketIP = "ip"
+)
+
+func bucketRate(bucket string) config.Rate {
+	switch bucket {
+	case BucketSearch:
+		return config.Cfg.RateSearch
+	case BucketCreate:
+		return config.Cfg.RateCreate
+	case BucketPublic:
+		return config.Cfg.RatePublic
+	case BucketIP:
+		return config.Cfg.RateIP
+	}
+	return config.Cfg.RateAPI
+}
+
+// routeBuckets moves individual routes out of the api bucket. Keys are the
+// method and the route pattern as gin matched it.
+var routeBuckets = map[string]string{
+	"GET /papers":                   BucketSearch,
+	"GET /papers/by-author/:author": BucketSearch,
+	"GET /papers/by-venue/:venue":   BucketSearch,
+	"GET /papers/trending":          BucketSearch,
+	"GET /authors":                  BucketSearch,
+	"POST /papers":                  BucketCreate,
+}
+
+// rateLimitCaller identifies whose quota a request counts against: the
+// client IP in the ip bucket, elsewhere the API key if one was used, else
+// the user, else the client IP.
+func rateLimitCaller(c *gin.Context, bucket string) string {
+	if bucket == BucketIP {
+		return "ip:" + c.ClientIP()
+	}
+	if id := c.GetString("api_key_id"); id != "" {
+		return "key:" + id
+	}
+	if id := c.GetString("user_id"); id != "" {
+		return "user:" + id
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimit enforces the quota of bucket on every request; the api bucket
+// defers to the route's own bucket in routeBuckets when it has one. The ip
+// bucket always counts per client IP. The others count per API key or user
+// when placed after AuthRequired, and per IP before it. If Redis is
+// unreachable requests are let through rather than failing the whole API.
+func RateLimit(bucket string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket := bucket
+		if b, ok := routeBuckets[c.Request.Method+" "+c.FullPath()]; ok && bucket == BucketAPI {
+			bucket = b
+		}
+		rate := bucketRate(bucket)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		allowed, used, reset, err := utils.SlidingWindowAllow(ctx,
+			utils.RateLimitKey(bucket, rateLimitCaller(c, bucket)), rate.Limit, rate.Window)
+		if err != nil {
+			log.Printf("rate limit %s: %v", bucket, err)
+			c.Next()
+			return
+		}
+
+		resetSecs := strconv.Itoa(int((reset + time.Second - 1) / time.Second))
+		c.Header("RateLimit-Policy", strconv.Itoa(rate.Limit)+";w="+strconv.Itoa(int(rate.Window.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(rate.Limit))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(max(int64(rate.Limit)-used, 0), 10))
+		c.Header("RateLimit-Reset", resetSecs)
+		if !allowed {
+			setRetryAfter(c, reset)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded", "bucket": bucket})
+			return
+		}
+		c.Next()
+	}
+}
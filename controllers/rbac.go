@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+type Permission string
+
+const (
+	// PermReadPapers allows searching and reading papers and authors.
+	PermReadPapers Permission = "papers:read"
+	// PermManageAccount allows managing one's own sessions, password and
+	// API keys. API keys never carry it.
+	PermManageAccount Permission = "account:manage"
+	// PermWritePapers allows uploading papers and editing one's own.
+	PermWritePapers Permission = "papers:write"
+	// PermCuratePapers allows editing, deleting and merging any paper.
+	PermCuratePapers Permission = "papers:curate"
+	// PermCurateAuthors allows deciding author claims and merging authors.
+	PermCurateAuthors Permission = "authors:curate"
+	// PermManageUsers allows listing users and changing their roles.
+	PermManageUsers Permission = "users:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleMember:  {PermReadPapers, PermManageAccount, PermWritePapers},
+	models.RoleCurator: {PermCuratePapers, PermCurateAuthors},
+	models.RoleAdmin:   {PermCuratePapers, PermCurateAuthors, PermManageUsers},
+}
+
+// grantableRoles are the roles admins hand out; membership comes with the
+// account and cannot be revoked.
+var grantableRoles = []string{models.RoleAdmin, models.RoleCurator}
+
+// callerRoles returns the effective roles of the authenticated user. They
+// are read once per request and cached on the gin context.
+func callerRoles(ctx context.Context, c *gin.Context) []string {
+	if v, ok := c.Get("roles"); ok {
+		return v.([]string)
+	}
+	roles := []string{models.RoleMember}
+	if uid, err := primitive.ObjectIDFromHex(c.GetString("user_id")); err == nil {
+		var u struct {
+			Roles       []string `bson:"roles"`
+			TOTPEnabled bool     `bson:"totp_enabled"`
+		}
+		if err := config.MongoClient.Database("research_db").Collection("users").
+			FindOne(ctx, bson.M{"_id": uid}, options.FindOne().SetProjection(bson.M{"roles": 1, "totp_enabled": 1})).Decode(&u); err == nil {
+			for _, r := range u.Roles {
+				// An admin who has not enrolled in two-factor login acts
+				// as an ordinary member until they do.
+				if r == models.RoleAdmin && !u.TOTPEnabled {
+					continue
+				}
+				roles = append(roles, r)
+			}
+		}
+	}
+	c.Set("roles", roles)
+	return roles
+}
+
+// hasPermission reports whether the caller's roles grant perm. Requests made
+// with an API key are further limited to the key's scopes.
+func hasPermission(ctx context.Context, c *gin.Context, perm Permission) bool {
+	if scopes, ok := c.Get("api_key_scopes"); ok && !scopesAllow(scopes.([]string), perm) {
+		return false
+	}
+	for _, r := range callerRoles(ctx, c) {
+		if slices.Contains(rolePermissions[r], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission rejects requests whose user lacks perm. It must run
+// after AuthRequired.
+func RequirePermission(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		if !hasPermission(ctx, c, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(perm)})
+			return
+		}
+		c.Next()
+	}
+}
+
+type UserSummary struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Username      string             `bson:"username" json:"username"`
+	Name          string             `bson:"name" json:"name"`
+	Email         string             `bson:"email" json:"email"`
+	EmailVerified bool               `bson:"email_verified" json:"email_verified"`
+	Roles         []string           `bson:"roles" json:"roles"`
+}
+
+// ListUsers returns users, optionally only those holding ?role= or whose
+// username starts with ?q=.
+func ListUsers(c *gin.Context) {
+	filter := bson.M{}
+	if role := c.Query("role"); role != "" {
+		filter["roles"] = role
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filter["username"] = bson.M{"$regex": "^" + regexp.QuoteMeta(q)}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	cur, err := config.MongoClient.Database("research_db").Collection("users").Find(ctx, filter,
+		options.Find().SetSort(bson.M{"username": 1}).SetLimit(maxSearchLimit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	users := []UserSummary{}
+	if err := cur.All(ctx, &users); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	for i := range users {
+		users[i].Roles = append([]string{models.RoleMember}, users[i].Roles...)
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func GrantRole(c *gin.Context) {
+	changeRole(c, true)
+}
+
+func RevokeRole(c *gin.Context) {
+	changeRole(c, false)
+}
+
+// changeRole adds or removes :role on user :id. The last admin cannot lose
+// the role, so the instance always stays manageable. The count before the
+// update only catches the common case: two admins revoking each other can
+// both pass it, so the count is taken again afterwards and a revocation
+// that left no admin is undone.
+func changeRole(c *gin.Context, grant bool) {
+	role := c.Param("role")
+	if !slices.Contains(grantableRoles, role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(grantableRoles, ", ")})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	users := config.MongoClient.Database("research_db").Collection("users")
+	update := bson.M{"$addToSet": bson.M{"roles": role}}
+	if !grant {
+		if role == models.RoleAdmin {
+			n, err := users.CountDocuments(ctx, bson.M{"roles": models.RoleAdmin, "_id": bson.M{"$ne": uid}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			if n == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "cannot revoke the last admin"})
+				return
+			}
+		}
+		update = bson.M{"$pull": bson.M{"roles": role}}
+	}
+
+	res, err := users.UpdateByID(ctx, uid, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if !grant && role == models.RoleAdmin && res.ModifiedCount > 0 {
+		n, err := users.CountDocuments(ctx, bson.M{"roles": models.RoleAdmin})
+		if err != nil || n == 0 {
+			// Restore even if ctx is what failed.
+			rctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, _ = users.UpdateByID(rctx, uid, bson.M{"$addToSet": bson.M{"roles": models.RoleAdmin}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			} else {
+				c.JSON(http.StatusConflict, gin.H{"error": "cannot revoke the last admin"})
+			}
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": uid.Hex(), "role": role, "granted": grant})
+}
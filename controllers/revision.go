@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+var errEditConflict = errors.New("paper was modified concurrently")
+
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+func snapshotOf(p models.Paper) models.PaperSnapshot {
+	return models.PaperSnapshot{
+		Title:             p.Title,
+		Authors:           p.Authors,
+		Abstract:          p.Abstract,
+		PublicationDate:   p.PublicationDate,
+		JournalConference: p.JournalConference,
+		Keywords:          p.Keywords,
+	}
+}
+
+// snapshotFields lists the snapshot fields by their bson name, in a fixed
+// order so that diffs and changed-field lists are stable.
+func snapshotFields(s models.PaperSnapshot) bson.D {
+	return bson.D{
+		{Key: "title", Value: s.Title},
+		{Key: "authors", Value: s.Authors},
+		{Key: "abstract", Value: s.Abstract},
+		{Key: "publication_date", Value: s.PublicationDate},
+		{Key: "journal_conference", Value: s.JournalConference},
+		{Key: "keywords", Value: s.Keywords},
+	}
+}
+
+func sameValue(a, b interface{}) bool {
+	switch av := a.(type) {
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	case []string:
+		bv, ok := b.([]string)
+		return ok && slices.Equal(av, bv)
+	default:
+		return a == b
+	}
+}
+
+func diffSnapshots(from, to models.PaperSnapshot) map[string]FieldChange {
+	a, b := snapshotFields(from), snapshotFields(to)
+	changes := map[string]FieldChange{}
+	for i := range a {
+		if !sameValue(a[i].Value, b[i].Value) {
+			changes[a[i].Key] = FieldChange{Old: a[i].Value, New: b[i].Value}
+		}
+	}
+	return changes
+}
+
+func changedFields(from, to models.PaperSnapshot) []string {
+	a, b := snapshotFields(from), snapshotFields(to)
+	changed := []string{}
+	for i := range a {
+		if !sameValue(a[i].Value, b[i].Value) {
+			changed = append(changed, a[i].Key)
+		}
+	}
+	return changed
+}
+
+func insertRevision(ctx context.Context, rev models.PaperRevision) error {
+	_, err := config.MongoClient.Database("research_db").Collection("paper_revisions").InsertOne(ctx, rev)
+	return err
+}
+
+// staleRevisionAge is how old a revision ahead of its paper must be before
+// it counts as left over from an edit that died between its two writes.
+const staleRevisionAge = time.Minute
+
+// claimRevision inserts rev, the revision an edit of cur is about to
+// create. The unique (paper_id, rev) index lets only one edit claim a
+// revision number. A claim left behind by an edit that never updated the
+// paper is taken over once it is stale.
+func claimRevision(ctx context.Context, cur models.Paper, rev models.PaperRevision) error {
+	err := insertRevision(ctx, rev)
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	res, err := config.MongoClient.Database("research_db").Collection("paper_revisions").DeleteOne(ctx, bson.M{
+		"paper_id":  rev.PaperID,
+		"rev":       rev.Rev,
+		"edited_at": bson.M{"$lt": time.Now().UTC().Add(-staleRevisionAge)},
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errEditConflict
+	}
+	// The paper may have reached this revision after all, in which case the
+	// stale claim was real and the caller's copy is out of date.
+	n, err := config.MongoClient.Database("research_db").Collection("papers").CountDocuments(ctx,
+		bson.M{"_id": cur.ID, "revision": bson.M{"$gte": rev.Rev}})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errEditConflict
+	}
+	return insertRevision(ctx, rev)
+}
+
+// applyPaperEdit writes next over the current paper and records the result
+// as a new revision. The revision is inserted first and the paper write is
+// conditional on the revision the caller read, so two concurrent edits
+// cannot both succeed and a failed write never leaves a gap in the history:
+// if the paper cannot be updated the revision is removed again. Papers that
+// predate revision tracking get their current state saved as revision 0
+// first.
+func applyPaperEdit(ctx context.Context, cur models.Paper, next models.PaperSnapshot, editor primitive.ObjectID, restoredFrom *int) (models.Paper, []string, error) {
+	changed := changedFields(snapshotOf(cur), next)
+	if len(changed) == 0 {
+		return cur, changed, nil
+	}
+
+	if cur.Revision == 0 {
+		base := models.PaperRevision{
+			PaperID:  cur.ID,
+			Rev:      0,
+			EditedBy: cur.UploadedBy,
+			EditedAt: cur.ID.Timestamp(),
+			Changed:  []string{},
+			Snapshot: snapshotOf(cur),
+		}
+		if err := insertRevision(ctx, base); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return cur, nil, err
+		}
+	}
+
+	rev := models.PaperRevision{
+		ID:           primitive.NewObjectID(),
+		PaperID:      cur.ID,
+		Rev:          cur.Revision + 1,
+		EditedBy:     editor,
+		EditedAt:     time.Now().UTC(),
+		Changed:      changed,
+		RestoredFrom: restoredFrom,
+		Snapshot:     next,
+	}
+	if err := claimRevision(ctx, cur, rev); err != nil {
+		return cur, nil, err
+	}
+
+	filter := bson.M{"_id": cur.ID, "revision": cur.Revision}
+	if cur.Revision == 0 {
+		filter = bson.M{"_id": cur.ID, "$or": bson.A{
+			bson.M{"revision": 0},
+			bson.M{"revision": bson.M{"$exists": false}},
+		}}
+	}
+	set := bson.M{}
+	for _, f := range snapshotFields(next) {
+		set[f.Key] = f.Value
+	}
+
+	var updated models.Paper
+	err := config.MongoClient.Database("research_db").Collection("papers").FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": set, "$inc": bson.M{"revision": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		// ctx may be what failed, so the cleanup gets its own. An error other
+		// than no match may hide a write that did go through, and then the
+		// revision has to stay.
+		dctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		applied := int64(0)
+		if err != mongo.ErrNoDocuments {
+			applied, _ = config.MongoClient.Database("research_db").Collection("papers").CountDocuments(dctx,
+				bson.M{"_id": cur.ID, "revision": bson.M{"$gte": rev.Rev}})
+		}
+		if applied == 0 {
+			_, _ = config.MongoClient.Database("research_db").Collection("paper_revisions").
+				DeleteOne(dctx, bson.M{"_id": rev.ID})
+		}
+		if err == mongo.ErrNoDocuments {
+			err = errEditConflict
+		}
+		return cur, nil, err
+	}
+	if slices.Contains(changed, "authors") || slices.Contains(changed, "publication_date") {
+		refreshMetricsAround(ctx, cur.ID, append(slices.Clone(cur.Authors), next.Authors...))
+	}
+	if slices.Contains(changed, "authors") {
+		utils.LinkAuthorsAsync(next.Authors)
+	}
+	return updated, changed, nil
+}
+
+// paperRevisionParams reads :id and :rev. Like rootParam it answers 404
+// for a paper in the trash, whose history is hidden along with it.
+func paperRevisionParams(ctx context.Context, c *gin.Context) (primitive.ObjectID, int, bool) {
+	oid, ok := rootParam(ctx, c, "id")
+	if !ok {
+		return oid, 0, false
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return oid, 0, false
+	}
+	return oid, rev, true
+}
+
+func findRevision(ctx context.Context, paperID primitive.ObjectID, rev int) (models.PaperRevision, error) {
+	var r models.PaperRevision
+	err := config.MongoClient.Database("research_db").Collection("paper_revisions").
+		FindOne(ctx, bson.M{"paper_id": paperID, "rev": rev}).Decode(&r)
+	return r, err
+}
+
+func ListPaperRevisions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	oid, ok := rootParam(ctx, c, "id")
+	if !ok {
+		return
+	}
+
+	cur, err := config.MongoClient.Database("research_db").Collection("paper_revisions").Find(ctx,
+		bson.M{"paper_id": oid},
+		options.Find().SetSort(bson.M{"rev": -1}).SetProjection(bson.M{"snapshot": 0}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	revs := []models.PaperRevision{}
+	if err := cur.All(ctx, &revs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(revs))
+	for _, r := range revs {
+		out = append(out, gin.H{
+			"rev":           r.Rev,
+			"edited_by":     r.EditedBy.Hex(),
+			"edited_at":     r.EditedAt,
+			"changed":       r.Changed,
+			"restored_from": r.RestoredFrom,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"paper_id": oid.Hex(), "revisions": out})
+}
+
+func GetPaperRevision(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	oid, rev, ok := paperRevisionParams(ctx, c)
+	if !ok {
+		return
+	}
+
+	r, err := findRevision(ctx, oid, rev)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// DiffPaperRevisions compares revision :rev against the revision given by
+// ?against=, defaulting to the one before it.
+func DiffPaperRevisions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	oid, rev, ok := paperRevisionParams(ctx, c)
+	if !ok {
+		return
+	}
+	against := rev - 1
+	if s := c.Query("against"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid against"})
+			return
+		}
+		against = n
+	}
+
+	to, err := findRevision(ctx, oid, rev)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	from, err := findRevision(ctx, oid, against)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision to compare against not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"paper_id": oid.Hex(),
+		"from":     against,
+		"to":       rev,
+		"changes":  diffSnapshots(from.Snapshot, to.Snapshot),
+	})
+}
+
+func RestorePaperRevision(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	_, rev, ok := paperRevisionParams(ctx, c)
+	if !ok {
+		return
+	}
+
+	paper, ok := loadEditablePaper(ctx, c, false)
+	if !ok {
+		return
+	}
+	old, err := findRevision(ctx, paper.ID, rev)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+
+	editor, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	updated, changed, err := applyPaperEdit(ctx, paper, old.Snapshot, editor, &rev)
+	if err == errEditConflict {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if len(changed) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Paper already matches revision", "paper": updated})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Revision restored", "revision": updated.Revision, "paper": updated})
+}
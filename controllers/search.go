@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	facetBucketLimit   = 10
+)
+
+type PaperSearchResult struct {
+	models.Paper  `bson:",inline"`
+	Score         float64 `bson:"score" json:"score"`
+	CitationCount int     `bson:"citation_count" json:"citation_count"`
+}
+
+type FacetBucket struct {
+	Value interface{} `bson:"_id" json:"value"`
+	Count int         `bson:"count" json:"count"`
+}
+
+type SearchFacets struct {
+	Keywords []FacetBucket `bson:"keywords" json:"keywords"`
+	Venues   []FacetBucket `bson:"venues" json:"venues"`
+	Years    []FacetBucket `bson:"years" json:"years"`
+	Authors  []FacetBucket `bson:"authors" json:"authors"`
+}
+
+// paperFilter holds the query parameters shared by the paper listing
+// endpoints. Repeated author/keyword parameters must all match.
+type paperFilter struct {
+	Text         string
+	Authors      []string
+	AnyAuthor    []string
+	Keywords     []string
+	Venue        string
+	From, To     time.Time
+	UploadedBy   primitive.ObjectID
+	MinCitations int
+}
+
+func parsePaperFilter(c *gin.Context) (paperFilter, string) {
+	f := paperFilter{
+		Text:     strings.TrimSpace(c.Query("search")),
+		Authors:  nonEmpty(c.QueryArray("author")),
+		Keywords: nonEmpty(c.QueryArray("keyword")),
+		Venue:    strings.TrimSpace(c.Query("journal_conference")),
+	}
+
+	var err error
+	if s := c.Query("from"); s != "" {
+		if f.From, err = time.Parse("2006-01-02", s); err != nil {
+			return f, "invalid from"
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if f.To, err = time.Parse("2006-01-02", s); err != nil {
+			return f, "invalid to"
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From) {
+		return f, "to is before from"
+	}
+	if s := c.Query("uploaded_by"); s != "" {
+		if f.UploadedBy, err = primitive.ObjectIDFromHex(s); err != nil {
+			return f, "invalid uploaded_by"
+		}
+	}
+	if s := c.Query("min_citations"); s != "" {
+		if f.MinCitations, err = strconv.Atoi(s); err != nil || f.MinCitations < 0 {
+			return f, "invalid min_citations"
+		}
+	}
+	return f, ""
+}
+
+func (f paperFilter) match() bson.M {
+	m := bson.M{"deleted_at": bson.M{"$exists": false}}
+	if f.Text != "" {
+		m["$text"] = bson.M{"$search": f.Text}
+	}
+	if len(f.Authors) > 0 {
+		m["authors"] = bson.M{"$all": f.Authors}
+	}
+	if len(f.AnyAuthor) > 0 {
+		m["$and"] = bson.A{bson.M{"authors": bson.M{"$in": f.AnyAuthor}}}
+	}
+	if len(f.Keywords) > 0 {
+		m["keywords"] = bson.M{"$all": f.Keywords}
+	}
+	if f.Venue != "" {
+		m["journal_conference"] = f.Venue
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		date := bson.M{}
+		if !f.From.IsZero() {
+			date["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			date["$lt"] = f.To.AddDate(0, 0, 1)
+		}
+		m["publication_date"] = date
+	}
+	if !f.UploadedBy.IsZero() {
+		m["uploaded_by"] = f.UploadedBy
+	}
+	return m
+}
+
+func nonEmpty(vals []string) []string {
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// citationCountStages adds a citation_count field counted from the
+// citations collection.
+func citationCountStages() []bson.M {
+	return []bson.M{
+		{"$lookup": bson.M{
+			"from":         "citations",
+			"localField":   "_id",
+			"foreignField": "cited_paper_id",
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"source_deleted": bson.M{"$ne": true}}},
+				bson.M{"$count": "n"},
+			},
+			"as": "citation_stats",
+		}},
+		{"$addFields": bson.M{"citation_count": bson.M{"$ifNull": bson.A{bson.M{"$first": "$citation_stats.n"}, 0}}}},
+		{"$project": bson.M{"citation_stats": 0}},
+	}
+}
+
+var paperSortFields = map[string]string{
+	"relevance":        "score",
+	"publication_date": "publication_date",
+	"views":            "views",
+	"citation_count":   "citation_count",
+	"title":            "title",
+	"pagerank":         "pagerank",
+}
+
+type paperPage struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Cursor *pageCursor
+}
+
+func parsePaperPage(c *gin.Context, f paperFilter) (paperPage, string) {
+	p := paperPage{Sort: c.Query("sort"), Limit: defaultSearchLimit}
+	if p.Sort == "" {
+		p.Sort = "publication_date"
+		if f.Text != "" {
+			p.Sort = "relevance"
+		}
+	}
+	if _, ok := paperSortFields[p.Sort]; !ok {
+		return p, "invalid sort"
+	}
+	if p.Sort == "relevance" && f.Text == "" {
+		return p, "relevance sort requires search"
+	}
+
+	switch c.DefaultQuery("order", "") {
+	case "":
+		p.Desc = p.Sort != "title"
+	case "desc":
+		p.Desc = true
+	case "asc":
+		p.Desc = false
+	default:
+		return p, "invalid order"
+	}
+
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return p, "invalid limit"
+		}
+		p.Limit = min(n, maxSearchLimit)
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		pc, err := decodeCursor(s)
+		if err != nil || pc.Sort != p.Sort || pc.Desc != p.Desc {
+			return p, "invalid cursor"
+		}
+		p.Cursor = &pc
+	}
+	return p, ""
+}
+
+func (p paperPage) sortStage() bson.M {
+	dir := 1
+	if p.Desc {
+		dir = -1
+	}
+	return bson.M{"$sort": bson.D{{Key: paperSortFields[p.Sort], Value: dir}, {Key: "_id", Value: dir}}}
+}
+
+func (p paperPage) cursorFor(r PaperSearchResult) string {
+	pc := pageCursor{Sort: p.Sort, Desc: p.Desc, ID: r.ID}
+	switch p.Sort {
+	case "relevance":
+		pc.Value = r.Score
+	case "publication_date":
+		pc.Value = r.PublicationDate
+	case "views":
+		pc.Value = r.Views
+	case "citation_count":
+		pc.Value = r.CitationCount
+	case "title":
+		pc.Value = r.Title
+	case "pagerank":
+		pc.Value = r.PageRank
+	}
+	return encodeCursor(pc)
+}
+
+func SearchPapers(c *gin.Context) {
+	f, msg := parsePaperFilter(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	listPapers(c, f)
+}
+
+func PapersByAuthor(c *gin.Context) {
+	f, msg := parsePaperFilter(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	f.Authors = append(f.Authors, c.Param("author"))
+	listPapers(c, f)
+}
+
+func PapersByVenue(c *gin.Context) {
+	f, msg := parsePaperFilter(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	f.Venue = c.Param("venue")
+	listPapers(c, f)
+}
+
+func listPapers(c *gin.Context, f paperFilter) {
+	page, msg := parsePaperPage(c, f)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	pipeline := []bson.M{{"$match": f.match()}}
+	if f.Text != "" {
+		pipeline = append(pipeline, bson.M{"$addFields": bson.M{"score": bson.M{"$meta": "textScore"}}})
+	}
+
+	// Counting citations for every matching paper is only needed when the
+	// filter or sort depends on it; otherwise count for the returned page only.
+	countAll := f.MinCitations > 0 || page.Sort == "citation_count"
+	if countAll {
+		pipeline = append(pipeline, citationCountStages()...)
+	}
+	if f.MinCitations > 0 {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"citation_count": bson.M{"$gte": f.MinCitations}}})
+	}
+
+	results := []bson.M{}
+	if page.Cursor != nil {
+		results = append(results, bson.M{"$match": page.Cursor.match(paperSortFields[page.Sort])})
+	}
+	results = append(results, page.sortStage(), bson.M{"$limit": page.Limit + 1})
+	if !countAll {
+		results = append(results, citationCountStages()...)
+	}
+
+	pipeline = append(pipeline, bson.M{"$facet": bson.M{
+		"results": results,
+		"total":   bson.A{bson.M{"$count": "n"}},
+		"keywords": bson.A{
+			bson.M{"$unwind": "$keywords"},
+			bson.M{"$sortByCount": "$keywords"},
+			bson.M{"$limit": facetBucketLimit},
+		},
+		"venues": bson.A{
+			bson.M{"$sortByCount": "$journal_conference"},
+			bson.M{"$limit": facetBucketLimit},
+		},
+		"years": bson.A{
+			bson.M{"$group": bson.M{"_id": bson.M{"$year": "$publication_date"}, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.M{"_id": -1}},
+		},
+		"authors": bson.A{
+			bson.M{"$unwind": "$authors"},
+			bson.M{"$sortByCount": "$authors"},
+			bson.M{"$limit": facetBucketLimit},
+		},
+	}})
+
+	cur, err := config.MongoClient.Database("research_db").Collection("papers").Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var out []struct {
+		Results []PaperSearchResult `bson:"results"`
+		Total   []struct {
+			N int `bson:"n"`
+		} `bson:"total"`
+		SearchFacets `bson:",inline"`
+	}
+	if err := cur.All(ctx, &out); err != nil || len(out) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	res := out[0]
+	total := 0
+	if len(res.Total) > 0 {
+		total = res.Total[0].N
+	}
+	if res.Results == nil {
+		res.Results = []PaperSearchResult{}
+	}
+
+	var next interface{}
+	if len(res.Results) > page.Limit {
+		res.Results = res.Results[:page.Limit]
+		next = page.cursorFor(res.Results[len(res.Results)-1])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":       f.Text,
+		"sort":        page.Sort,
+		"total":       total,
+		"count":       len(res.Results),
+		"results":     res.Results,
+		"next_cursor": next,
+		"facets":      res.SearchFacets,
+	})
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	// lastSeenResolution limits how often a request rewrites last_seen.
+	lastSeenResolution = time.Minute
+	// sessionIdleLimit drops sessions nobody has used for this long when
+	// sessions are listed; it matches the cookie store's default max age.
+	sessionIdleLimit = 30 * 24 * time.Hour
+)
+
+// SessionInfo describes one login of a user, whether it is carried by the
+// session cookie or by a refresh token family.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current,omitempty"`
+}
+
+func startSession(ctx context.Context, c *gin.Context, userID, method string) (string, error) {
+	now := time.Now().UTC()
+	info := SessionInfo{
+		ID:        utils.RandomToken(16),
+		Device:    c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		Method:    method,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+	raw, _ := json.Marshal(info)
+	if err := config.Redis.HSet(ctx, utils.UserSessionsKey(userID), info.ID, raw).Err(); err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+// touchSession reports whether the session is still live and bumps its
+// last_seen timestamp if that is stale.
+func touchSession(ctx context.Context, c *gin.Context, userID, sid string) (bool, error) {
+	key := utils.UserSessionsKey(userID)
+	raw, err := config.Redis.HGet(ctx, key, sid).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, err
+	}
+	var info SessionInfo
+	if json.Unmarshal(raw, &info) == nil && time.Since(info.LastSeen) > lastSeenResolution {
+		info.LastSeen = time.Now().UTC()
+		info.IP = c.ClientIP()
+		raw, _ = json.Marshal(info)
+		_ = config.Redis.HSet(ctx, key, sid, raw).Err()
+	}
+	return true, nil
+}
+
+// endSessions revokes the given sessions of a user, or all of them except
+// keep when ids is nil. Token families share the session ID, so their
+// refresh tokens die with it.
+func endSessions(ctx context.Context, userID string, ids []string, keep string) (int, error) {
+	key := utils.UserSessionsKey(userID)
+	if ids == nil {
+		all, err := config.Redis.HKeys(ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		for _, id := range all {
+			if id != keep {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	n, err := config.Redis.HDel(ctx, key, ids...).Result()
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		_ = config.Redis.Set(ctx, utils.RefreshFamilyRevokedKey(id), 1, config.Cfg.RefreshTokenTTL).Err()
+	}
+	return int(n), nil
+}
+
+func Logout(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID := c.GetString("user_id")
+	sid := c.GetString("session_id")
+	if _, err := endSessions(ctx, userID, []string{sid}, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+
+	if v, ok := c.Get("token_claims"); ok {
+		claims := v.(utils.AccessClaims)
+		_ = config.Redis.Set(ctx, utils.RevokedAccessTokenKey(claims.ID), 1,
+			time.Until(time.Unix(claims.ExpiresAt, 0))).Err()
+	} else {
+		session := sessions.Default(c)
+		session.Clear()
+		session.Options(sessions.Options{Path: "/", MaxAge: -1})
+		_ = session.Save()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func ListSessions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID := c.GetString("user_id")
+	key := utils.UserSessionsKey(userID)
+	all, err := config.Redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+
+	out := make([]SessionInfo, 0, len(all))
+	var stale []string
+	for id, raw := range all {
+		var info SessionInfo
+		if json.Unmarshal([]byte(raw), &info) != nil || time.Since(info.LastSeen) > sessionIdleLimit {
+			stale = append(stale, id)
+			continue
+		}
+		info.Current = id == c.GetString("session_id")
+		out = append(out, info)
+	}
+	if len(stale) > 0 {
+		_ = config.Redis.HDel(ctx, key, stale...).Err()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+func RevokeSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	n, err := endSessions(ctx, c.GetString("user_id"), []string{c.Param("id")}, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessions logs the user out everywhere. The calling session
+// survives only with ?keep_current=true.
+func RevokeAllSessions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keep := ""
+	if c.Query("keep_current") == "true" {
+		keep = c.GetString("session_id")
+	}
+	n, err := endSessions(ctx, c.GetString("user_id"), nil, keep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": n})
+}
+
+type ChangePasswordBody struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword replaces the caller's password and then ends every other
+// session, so a stolen session or token cannot outlive the change.
+func ChangePassword(c *gin.Context) {
+	var b ChangePasswordBody
+	if err := c.BindJSON(&b); err != nil || b.CurrentPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users := config.MongoClient.Database("research_db").Collection("users")
+	var u models.User
+	if err := users.FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+		return
+	}
+	if !utils.CheckPassword(b.CurrentPassword, u.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if err := utils.CheckPasswordStrength(b.NewPassword, u.Username, u.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashed, err := utils.HashPassword(b.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "hash error"})
+		return
+	}
+	if _, err := users.UpdateByID(ctx, uid, bson.M{"$set": bson.M{"password": hashed}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	n, err := endSessions(ctx, uid.Hex(), nil, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password changed but sessions could not be revoked"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "sessions_revoked": n})
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	maxStatsBuckets = 1000
+	// hourlyLookback is how far back Redis may still hold hours the rollup
+	// job has not moved to Mongo; it matches the hourly keys' TTL.
+	hourlyLookback = 7 * 24 * time.Hour
+)
+
+// statsTrunc maps each granularity to the start of the bucket holding t.
+// Weeks start on Monday, as in $dateTrunc with startOfWeek "monday".
+var statsTrunc = map[string]func(time.Time) time.Time{
+	"hour": func(t time.Time) time.Time { return t.Truncate(time.Hour) },
+	"day": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	},
+	"week": func(t time.Time) time.Time {
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	},
+	"month": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	},
+}
+
+func statsNext(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case "hour":
+		return t.Add(time.Hour)
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// parseStatsTime accepts RFC 3339 or a plain date. A plain date given as the
+// end of a range includes that whole day.
+func parseStatsTime(s string, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), true
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, false
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+func dateTrunc(date interface{}, granularity string) bson.M {
+	spec := bson.M{"date": date, "unit": granularity}
+	if granularity == "week" {
+		spec["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": spec}
+}
+
+// GetPaperStats returns a paper's views and new citations over time, in
+// ?granularity= hour, day (the default), week or month buckets between
+// ?from= and ?to= (the last 30 days by default). Citations are dated by
+// when they were recorded, which is the creation time in their ObjectID.
+func GetPaperStats(c *gin.Context) {
+	granularity := c.DefaultQuery("granularity", "day")
+	trunc, ok := statsTrunc[granularity]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be hour, day, week or month"})
+		return
+	}
+	to := time.Now().UTC()
+	if s := c.Query("to"); s != "" {
+		if to, ok = parseStatsTime(s, true); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -30)
+	if s := c.Query("from"); s != "" {
+		if from, ok = parseStatsTime(s, false); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	var starts []time.Time
+	index := map[time.Time]int{}
+	for t := trunc(from); t.Before(to); t = statsNext(t, granularity) {
+		if len(starts) == maxStatsBuckets {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "range too large for this granularity"})
+			return
+		}
+		index[t] = len(starts)
+		starts = append(starts, t)
+	}
+	from = starts[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	oid, ok := rootParam(ctx, c, "id")
+	if !ok {
+		return
+	}
+	db := config.MongoClient.Database("research_db")
+	buckets := make([]models.StatsBucket, len(starts))
+	for i, t := range starts {
+		buckets[i].Start = t
+	}
+
+	type count struct {
+		Start time.Time `bson:"_id"`
+		N     int64     `bson:"n"`
+	}
+
+	// Rolled-up hours may appear twice after an interrupted rollup, with
+	// the same count; the first $group collapses them.
+	cur, err := db.Collection("paper_view_stats").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"paper_id": oid, "ts": bson.M{"$gte": from, "$lt": to}}},
+		{"$group": bson.M{"_id": "$ts", "views": bson.M{"$max": "$views"}}},
+		{"$group": bson.M{"_id": dateTrunc("$_id", granularity), "n": bson.M{"$sum": "$views"}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var views []count
+	if err := cur.All(ctx, &views); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	for _, v := range views {
+		if i, ok := index[v.Start.UTC()]; ok {
+			buckets[i].Views += v.N
+		}
+	}
+
+	if err := addUnrolledViews(ctx, oid, from, to, granularity, index, buckets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	cur, err = db.Collection("citations").Aggregate(ctx, []bson.M{
+		{"$match": bson.M{
+			"cited_paper_id": oid,
+			"source_deleted": bson.M{"$ne": true},
+			"_id": bson.M{
+				"$gte": primitive.NewObjectIDFromTimestamp(from),
+				"$lt":  primitive.NewObjectIDFromTimestamp(to),
+			},
+		}},
+		{"$group": bson.M{"_id": dateTrunc(bson.M{"$toDate": "$_id"}, granularity), "n": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var cites []count
+	if err := cur.All(ctx, &cites); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	for _, n := range cites {
+		if i, ok := index[n.Start.UTC()]; ok {
+			buckets[i].Citations += n.N
+		}
+	}
+
+	var totalViews, totalCitations int64
+	for _, b := range buckets {
+		totalViews += b.Views
+		totalCitations += b.Citations
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"paper_id":    oid.Hex(),
+		"granularity": granularity,
+		"from":        from,
+		"to":          to,
+		"totals":      gin.H{"views": totalViews, "citations": totalCitations},
+		"buckets":     buckets,
+	})
+}
+
+// addUnrolledViews adds the views of recent hours that are still only in
+// Redis. Hours the rollup job has already written to Mongo are skipped,
+// even if their Redis hash has not been deleted yet.
+func addUnrolledViews(ctx context.Context, oid primitive.ObjectID, from, to time.Time, granularity string,
+	index map[time.Time]int, buckets []models.StatsBucket) error {
+	first := time.Now().UTC().Add(-hourlyLookback)
+	if from.After(first) {
+		first = from
+	}
+	first = first.Truncate(time.Hour)
+	var hours []time.Time
+	for h := first; h.Before(to) && !h.After(time.Now()); h = h.Add(time.Hour) {
+		hours = append(hours, h)
+	}
+	if len(hours) == 0 {
+		return nil
+	}
+
+	pipe := config.Redis.Pipeline()
+	for _, h := range hours {
+		pipe.HGet(ctx, utils.PaperViewsHourlyKey(h), oid.Hex())
+	}
+	cmds, _ := pipe.Exec(ctx)
+	live := map[time.Time]int64{}
+	var liveHours bson.A
+	for i, cmd := range cmds {
+		n, err := cmd.(*redis.StringCmd).Int64()
+		if err == nil && n > 0 {
+			live[hours[i]] = n
+			liveHours = append(liveHours, hours[i])
+		}
+	}
+	if len(live) == 0 {
+		return nil
+	}
+
+	rolled, err := config.MongoClient.Database("research_db").Collection("paper_view_stats").
+		Distinct(ctx, "ts", bson.M{"paper_id": oid, "ts": bson.M{"$in": liveHours}})
+	if err != nil {
+		return err
+	}
+	for _, ts := range rolled {
+		if d, ok := ts.(primitive.DateTime); ok {
+			delete(live, d.Time().UTC())
+		}
+	}
+	trunc := statsTrunc[granularity]
+	for h, n := range live {
+		if i, ok := index[trunc(h)]; ok {
+			buckets[i].Views += n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	// The first freeLoginFailures failures in the window cost nothing. After
+	// that each failure doubles the wait before the next attempt, starting
+	// at baseLoginDelay and capped at maxLoginDelay.
+	freeLoginFailures = 3
+	baseLoginDelay    = time.Second
+	maxLoginDelay     = 30 * time.Second
+)
+
+func setRetryAfter(c *gin.Context, d time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// lockRemaining returns how long username stays locked, or 0.
+func lockRemaining(ctx context.Context, username string) (time.Duration, error) {
+	d, err := config.Redis.PTTL(ctx, utils.LoginLockKey(username)).Result()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	return max(d, 0), nil
+}
+
+// loginAllowed checks the lock, the progressive delay and the per-IP limit
+// before any password is hashed. It writes the error response itself.
+func loginAllowed(ctx context.Context, c *gin.Context, username string) bool {
+	locked, err := lockRemaining(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return false
+	}
+	if locked > 0 {
+		setRetryAfter(c, locked)
+		c.JSON(http.StatusLocked, gin.H{"error": "account temporarily locked"})
+		return false
+	}
+
+	delay, err := config.Redis.PTTL(ctx, utils.LoginDelayKey(username)).Result()
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return false
+	}
+	if delay > 0 {
+		setRetryAfter(c, delay)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts, retry later"})
+		return false
+	}
+
+	n, expires, err := utils.SlidingWindowCount(ctx, utils.LoginFailuresIPKey(c.ClientIP()), config.Cfg.LoginFailureWindow)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return false
+	}
+	if n >= int64(config.Cfg.LoginMaxFailuresPerIP) {
+		setRetryAfter(c, time.Until(expires))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts from this address"})
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed password or second-factor attempt
+// against both the username and the client IP, and locks or slows down
+// further attempts as the counts grow.
+func recordLoginFailure(ctx context.Context, c *gin.Context, username string) {
+	ip := c.ClientIP()
+	window := config.Cfg.LoginFailureWindow
+
+	if n, err := utils.SlidingWindowHit(ctx, utils.LoginFailuresIPKey(ip), window); err == nil &&
+		n == int64(config.Cfg.LoginMaxFailuresPerIP) {
+		utils.Audit(ctx, models.AuditEvent{Action: models.AuditLoginIPBlocked, IP: ip,
+			Details: map[string]any{"failures": n, "window": window.String()}})
+	}
+
+	n, err := utils.SlidingWindowHit(ctx, utils.LoginFailuresUserKey(username), window)
+	if err != nil {
+		return
+	}
+	switch {
+	case n >= int64(config.Cfg.LoginMaxFailures):
+		_ = config.Redis.Set(ctx, utils.LoginLockKey(username), ip, config.Cfg.LoginLockout).Err()
+		_ = config.Redis.Del(ctx, utils.LoginFailuresUserKey(username), utils.LoginDelayKey(username)).Err()
+		utils.Audit(ctx, models.AuditEvent{Action: models.AuditLoginLockout, Username: username, IP: ip,
+			Details: map[string]any{"failures": n, "lockout": config.Cfg.LoginLockout.String()}})
+	case n > freeLoginFailures:
+		delay := min(baseLoginDelay<<min(n-freeLoginFailures-1, 16), maxLoginDelay)
+		_ = config.Redis.Set(ctx, utils.LoginDelayKey(username), 1, delay).Err()
+	}
+}
+
+// clearLoginFailures forgets a username's failures once it logs in fully.
+func clearLoginFailures(ctx context.Context, username string) {
+	_ = config.Redis.Del(ctx, utils.LoginFailuresUserKey(username), utils.LoginDelayKey(username)).Err()
+}
+
+// UnlockUser lifts a lockout and clears the failure count of user :id.
+func UnlockUser(c *gin.Context) {
+	uid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	var u models.User
+	if err := config.MongoClient.Database("research_db").Collection("users").
+		FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	n, err := config.Redis.Del(ctx, utils.LoginLockKey(u.Username),
+		utils.LoginFailuresUserKey(u.Username), utils.LoginDelayKey(u.Username)).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+
+	actor, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	utils.Audit(ctx, models.AuditEvent{Action: models.AuditLoginUnlock, Username: u.Username,
+		ActorID: &actor, IP: c.ClientIP()})
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked", "user_id": uid.Hex(), "cleared": n > 0})
+}
+
+// ListAuditLog returns the newest audit events, optionally only those with
+// ?action= or concerning ?username=.
+func ListAuditLog(c *gin.Context) {
+	filter := bson.M{}
+	if a := c.Query("action"); a != "" {
+		filter["action"] = a
+	}
+	if u := c.Query("username"); u != "" {
+		filter["username"] = u
+	}
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	cur, err := config.MongoClient.Database("research_db").Collection("audit_log").Find(ctx, filter,
+		options.Find().SetSort(bson.M{"at": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	events := []models.AuditEvent{}
+	if err := cur.All(ctx, &events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
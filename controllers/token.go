@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"DB_HW5/config"
+	"DB_HW5/utils"
+)
+
+// refreshRecord is stored in Redis under the hash of each live refresh
+// token. Every token issued by rotating another one shares its family, so a
+// replayed token can take the whole chain down. The family is the ID of the
+// login session the chain belongs to.
+type refreshRecord struct {
+	UserID string `json:"user_id"`
+	Family string `json:"family"`
+}
+
+// issueTokens creates an access token and a refresh token for the user's
+// login session sid.
+func issueTokens(ctx context.Context, userID, sid string) (gin.H, error) {
+	access, claims, err := utils.SignAccessToken(config.Cfg.TokenSecret, userID, sid, config.Cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh := utils.RandomToken(32)
+	rec, _ := json.Marshal(refreshRecord{UserID: userID, Family: sid})
+	if err := config.Redis.Set(ctx, utils.RefreshTokenKey(utils.TokenHash(refresh)), rec, config.Cfg.RefreshTokenTTL).Err(); err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"expires_in":    claims.ExpiresAt - claims.IssuedAt,
+		"refresh_token": refresh,
+	}, nil
+}
+
+// bearerClaims validates an Authorization: Bearer token and returns its
+// claims. ok is false when no bearer token was sent at all.
+func bearerClaims(ctx context.Context, c *gin.Context) (claims utils.AccessClaims, ok bool, err error) {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return claims, false, nil
+	}
+	claims, err = utils.ParseAccessToken(config.Cfg.TokenSecret, strings.TrimSpace(token))
+	if err != nil {
+		return claims, true, err
+	}
+	revoked, err := config.Redis.Exists(ctx, utils.RevokedAccessTokenKey(claims.ID)).Result()
+	if err != nil {
+		return claims, true, err
+	}
+	if revoked > 0 {
+		return claims, true, utils.ErrInvalidToken
+	}
+	c.Set("token_claims", claims)
+	return claims, true, nil
+}
+
+type RefreshBody struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken trades a refresh token for a new access and refresh token.
+// Each refresh token works once; presenting one that was already rotated out
+// revokes every token descended from the same login.
+func RefreshToken(c *gin.Context) {
+	var b RefreshBody
+	if err := c.BindJSON(&b); err != nil || b.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := utils.TokenHash(b.RefreshToken)
+	raw, err := config.Redis.GetDel(ctx, utils.RefreshTokenKey(hash)).Bytes()
+	if err == redis.Nil {
+		if family, err := config.Redis.Get(ctx, utils.RefreshUsedKey(hash)).Result(); err == nil {
+			_ = config.Redis.Set(ctx, utils.RefreshFamilyRevokedKey(family), 1, config.Cfg.RefreshTokenTTL).Err()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected; session revoked"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+
+	var rec refreshRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	revoked, err := config.Redis.Exists(ctx, utils.RefreshFamilyRevokedKey(rec.Family)).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	live, err := touchSession(ctx, c, rec.UserID, rec.Family)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	if revoked > 0 || !live {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token revoked"})
+		return
+	}
+	_ = config.Redis.Set(ctx, utils.RefreshUsedKey(hash), rec.Family, config.Cfg.RefreshTokenTTL).Err()
+
+	tokens, err := issueTokens(ctx, rec.UserID, rec.Family)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken revokes the refresh token in the body, along with every token
+// rotated from it, and the bearer access token used to call it if any.
+func RevokeToken(c *gin.Context) {
+	var b RefreshBody
+	_ = c.ShouldBindJSON(&b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked := false
+	if b.RefreshToken != "" {
+		raw, err := config.Redis.GetDel(ctx, utils.RefreshTokenKey(utils.TokenHash(b.RefreshToken))).Bytes()
+		if err == nil {
+			var rec refreshRecord
+			if json.Unmarshal(raw, &rec) == nil {
+				_ = config.Redis.Set(ctx, utils.RefreshFamilyRevokedKey(rec.Family), 1, config.Cfg.RefreshTokenTTL).Err()
+				revoked = true
+			}
+		}
+	}
+	if claims, ok, err := bearerClaims(ctx, c); ok && err == nil {
+		ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+		_ = config.Redis.Set(ctx, utils.RevokedAccessTokenKey(claims.ID), 1, ttl).Err()
+		revoked = true
+	}
+
+	if !revoked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no valid token to revoke"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+// ListTrash returns the caller's soft-deleted papers that are still
+// restorable. Curators may pass ?all=true to see everyone's.
+func ListTrash(c *gin.Context) {
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deleted_at": bson.M{"$exists": true}}
+	if !(c.Query("all") == "true" && hasPermission(ctx, c, PermCuratePapers)) {
+		filter["uploaded_by"] = uid
+	}
+
+	cur, err := config.MongoClient.Database("research_db").Collection("papers").Find(ctx, filter,
+		options.Find().SetSort(bson.M{"deleted_at": -1}).SetLimit(maxSearchLimit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	papers := []models.Paper{}
+	if err := cur.All(ctx, &papers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(papers))
+	for _, p := range papers {
+		out = append(out, gin.H{
+			"id":         p.ID.Hex(),
+			"title":      p.Title,
+			"deleted_at": p.DeletedAt,
+			"deleted_by": p.DeletedBy.Hex(),
+			"purge_at":   p.DeletedAt.Add(config.Cfg.PaperRetention),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"papers": out})
+}
+
+func RestorePaper(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	paper, ok := loadEditablePaper(ctx, c, true)
+	if !ok {
+		return
+	}
+	if paper.MergedInto != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "paper was merged", "merged_into": paper.MergedInto.Hex()})
+		return
+	}
+	if time.Since(*paper.DeletedAt) > config.Cfg.PaperRetention {
+		c.JSON(http.StatusGone, gin.H{"error": "retention window has passed"})
+		return
+	}
+
+	db := config.MongoClient.Database("research_db")
+	if _, err := db.Collection("papers").UpdateByID(ctx, paper.ID,
+		bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := db.Collection("citations").UpdateMany(ctx,
+		bson.M{"paper_id": paper.ID},
+		bson.M{"$unset": bson.M{"source_deleted": ""}},
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "citation update error"})
+		return
+	}
+
+	refreshMetricsAround(ctx, paper.ID, paper.Authors)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Paper restored", "paper_id": paper.ID.Hex()})
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	// trendingChunk is how many ranked ids are read from Redis at a time
+	// while filtering; trendingMaxScan bounds how far down the ranking a
+	// narrow filter may look before giving up.
+	trendingChunk   = 200
+	trendingMaxScan = 2000
+)
+
+type TrendingPaper struct {
+	PaperSummary
+	Score float64 `json:"score"`
+}
+
+// GetTrendingPapers ranks papers by their decayed view and citation activity
+// in the chosen window. Scores live in Redis; Mongo only filters and fills
+// in the details, so the ranking is read in chunks until enough papers pass
+// the filter.
+func GetTrendingPapers(c *gin.Context) {
+	window := c.DefaultQuery("window", "24h")
+	if _, ok := utils.TrendingWindows[window]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window"})
+		return
+	}
+	f := paperFilter{
+		Keywords: nonEmpty(c.QueryArray("keyword")),
+		Venue:    strings.TrimSpace(c.Query("venue")),
+	}
+	limit := defaultSearchLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	papers := config.MongoClient.Database("research_db").Collection("papers")
+	out := []TrendingPaper{}
+	for start := int64(0); start < trendingMaxScan && len(out) < limit; start += trendingChunk {
+		ranked, err := config.Redis.ZRevRangeWithScores(ctx, utils.TrendingKey(window), start, start+trendingChunk-1).Result()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+			return
+		}
+		ids := make([]primitive.ObjectID, 0, len(ranked))
+		for _, z := range ranked {
+			if oid, err := primitive.ObjectIDFromHex(z.Member.(string)); err == nil {
+				ids = append(ids, oid)
+			}
+		}
+		if len(ids) > 0 {
+			match := f.match()
+			match["_id"] = bson.M{"$in": ids}
+			cur, err := papers.Find(ctx, match)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			var found []models.Paper
+			if err := cur.All(ctx, &found); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			byID := make(map[string]models.Paper, len(found))
+			for _, p := range found {
+				byID[p.ID.Hex()] = p
+			}
+			for _, z := range ranked {
+				p, ok := byID[z.Member.(string)]
+				if !ok {
+					continue
+				}
+				out = append(out, TrendingPaper{PaperSummary: summaryOf(p), Score: z.Score})
+				if len(out) == limit {
+					break
+				}
+			}
+		}
+		if int64(len(ranked)) < trendingChunk {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"window": window, "papers": out})
+}
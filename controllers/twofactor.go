@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	maxLoginChallengeAttempts = 5
+	recoveryCodeCount         = 10
+)
+
+// startLoginChallenge parks a password-verified login until the second
+// factor arrives, and returns the token the client sends it back with.
+func startLoginChallenge(ctx context.Context, userID, username string, issueTokens bool) (string, error) {
+	token := utils.RandomToken(24)
+	key := utils.LoginChallengeKey(utils.TokenHash(token))
+	pipe := config.Redis.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userID, "username", username, "issue_tokens", strconv.FormatBool(issueTokens))
+	pipe.Expire(ctx, key, loginChallengeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code,
+// for the user. Both are single-use: a TOTP code is tied to its time step and
+// a recovery code is removed once it matches.
+func verifySecondFactor(ctx context.Context, uid primitive.ObjectID, code, recoveryCode string) (bool, error) {
+	users := config.MongoClient.Database("research_db").Collection("users")
+	if recoveryCode != "" {
+		hash := utils.RecoveryCodeHash(recoveryCode)
+		res, err := users.UpdateOne(ctx,
+			bson.M{"_id": uid, "totp_enabled": true, "recovery_codes": hash},
+			bson.M{"$pull": bson.M{"recovery_codes": hash}})
+		if err != nil {
+			return false, err
+		}
+		return res.ModifiedCount == 1, nil
+	}
+
+	var u models.User
+	if err := users.FindOne(ctx, bson.M{"_id": uid, "totp_enabled": true}).Decode(&u); err != nil {
+		return false, nil
+	}
+	step, ok := utils.VerifyTOTP(u.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	res, err := users.UpdateOne(ctx, bson.M{"_id": uid, "$or": bson.A{
+		bson.M{"totp_last_step": bson.M{"$exists": false}},
+		bson.M{"totp_last_step": bson.M{"$lt": step}},
+	}}, bson.M{"$set": bson.M{"totp_last_step": step}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// newRecoveryCodes stores a fresh set of recovery codes for the user,
+// replacing any old ones, and returns them in the clear.
+func newRecoveryCodes(ctx context.Context, uid primitive.ObjectID, set bson.M) ([]string, error) {
+	codes := utils.NewRecoveryCodes(recoveryCodeCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.RecoveryCodeHash(code)
+	}
+	if set == nil {
+		set = bson.M{}
+	}
+	set["recovery_codes"] = hashes
+	_, err := config.MongoClient.Database("research_db").Collection("users").
+		UpdateByID(ctx, uid, bson.M{"$set": set})
+	return codes, err
+}
+
+type LoginTwoFactorBody struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginTwoFactor finishes a login started by Login for an account with
+// two-factor authentication.
+func LoginTwoFactor(c *gin.Context) {
+	var b LoginTwoFactorBody
+	if err := c.BindJSON(&b); err != nil || b.MFAToken == "" || (b.Code == "" && b.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := utils.LoginChallengeKey(utils.TokenHash(b.MFAToken))
+	challenge, err := config.Redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(challenge["user_id"])
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login expired, start again"})
+		return
+	}
+	locked, err := lockRemaining(ctx, challenge["username"])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	if locked > 0 {
+		// The account was locked after this login passed its password
+		// check; the challenge dies with it.
+		_ = config.Redis.Del(ctx, key).Err()
+		setRetryAfter(c, locked)
+		c.JSON(http.StatusLocked, gin.H{"error": "account temporarily locked"})
+		return
+	}
+	attempts, err := config.Redis.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	if attempts > maxLoginChallengeAttempts {
+		_ = config.Redis.Del(ctx, key).Err()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "too many attempts, start again"})
+		return
+	}
+
+	ok, err := verifySecondFactor(ctx, uid, b.Code, b.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if !ok {
+		recordLoginFailure(ctx, c, challenge["username"])
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	// Only one request may turn the challenge into a session.
+	if n, err := config.Redis.Del(ctx, key).Result(); err != nil || n == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login expired, start again"})
+		return
+	}
+
+	resp := gin.H{"message": "Login successful", "user_id": uid.Hex()}
+	if b.RecoveryCode != "" {
+		var u models.User
+		_ = config.MongoClient.Database("research_db").Collection("users").
+			FindOne(ctx, bson.M{"_id": uid}).Decode(&u)
+		resp["recovery_codes_left"] = len(u.RecoveryCodes)
+	}
+	issue, _ := strconv.ParseBool(challenge["issue_tokens"])
+	completeLogin(ctx, c, uid.Hex(), challenge["username"], issue, resp)
+}
+
+// EnrollTOTP starts two-factor enrollment. The returned URI is meant to be
+// shown as a QR code; enrollment takes effect once ConfirmTOTP sees a valid
+// code from it. Like password resets, it needs a verified email.
+func EnrollTOTP(c *gin.Context) {
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users := config.MongoClient.Database("research_db").Collection("users")
+	var u models.User
+	if err := users.FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+		return
+	}
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication already enabled"})
+		return
+	}
+	if !u.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "verify your email first"})
+		return
+	}
+
+	secret := utils.NewTOTPSecret()
+	if _, err := users.UpdateByID(ctx, uid, bson.M{"$set": bson.M{"totp_pending_secret": secret}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPURI(config.Cfg.TOTPIssuer, u.Username, secret),
+	})
+}
+
+type TOTPCodeBody struct {
+	Code string `json:"code"`
+}
+
+// ConfirmTOTP switches two-factor authentication on and returns the
+// account's recovery codes. They are not shown again.
+func ConfirmTOTP(c *gin.Context) {
+	var b TOTPCodeBody
+	if err := c.BindJSON(&b); err != nil || b.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var u models.User
+	if err := config.MongoClient.Database("research_db").Collection("users").
+		FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+		return
+	}
+	if u.TOTPPendingSecret == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "no enrollment in progress"})
+		return
+	}
+	step, ok := utils.VerifyTOTP(u.TOTPPendingSecret, b.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+
+	codes, err := newRecoveryCodes(ctx, uid, bson.M{
+		"totp_enabled":        true,
+		"totp_secret":         u.TOTPPendingSecret,
+		"totp_pending_secret": "",
+		"totp_last_step":      step,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+}
+
+type DisableTOTPBody struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTOTP turns two-factor authentication off. It asks for both the
+// password and a second factor so a hijacked session cannot do it alone.
+func DisableTOTP(c *gin.Context) {
+	var b DisableTOTPBody
+	if err := c.BindJSON(&b); err != nil || b.Password == "" || (b.Code == "" && b.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users := config.MongoClient.Database("research_db").Collection("users")
+	var u models.User
+	if err := users.FindOne(ctx, bson.M{"_id": uid}).Decode(&u); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+		return
+	}
+	if !utils.CheckPassword(b.Password, u.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	ok, err := verifySecondFactor(ctx, uid, b.Code, b.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+
+	if _, err := users.UpdateByID(ctx, uid, bson.M{
+		"$set":   bson.M{"totp_enabled": false},
+		"$unset": bson.M{"totp_secret": "", "totp_last_step": "", "recovery_codes": ""},
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current TOTP code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var b TOTPCodeBody
+	if err := c.BindJSON(&b); err != nil || b.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	uid, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ok, err := verifySecondFactor(ctx, uid, b.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	codes, err := newRecoveryCodes(ctx, uid, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
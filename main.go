@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"DB_HW5/config"
 	"DB_HW5/routes"
@@ -13,14 +18,41 @@ import (
 func main() {
 	config.Init()
 	utils.EnsureIndexes()
-	scheduler.StartViewsSync()
+	scheduler.Start()
 
-	r := routes.SetupRouter()
-	addr := getEnv("HTTP_ADDR", ":8080")
-	log.Printf("listening on %s", addr)
-	if err := r.Run(addr); err != nil {
-		panic(err)
+	srv := &http.Server{
+		Addr:    getEnv("HTTP_ADDR", ":8080"),
+		Handler: routes.SetupRouter(),
 	}
+	go func() {
+		log.Printf("listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	log.Printf("shutting down")
+
+	// Requests and jobs wind down side by side under one deadline; jobs
+	// still running at the end of it are cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), config.Cfg.ShutdownTimeout)
+	defer cancel()
+	jobsDone := make(chan struct{})
+	go func() {
+		if err := scheduler.Shutdown(ctx); err != nil {
+			log.Printf("scheduler shutdown: %v", err)
+		}
+		close(jobsDone)
+	}()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	<-jobsDone
+	_ = config.Redis.Close()
+	_ = config.MongoClient.Disconnect(context.Background())
 }
 
 func getEnv(k, def string) string {
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions.
+const (
+	AuditLoginLockout   = "login.lockout"
+	AuditLoginIPBlocked = "login.ip_blocked"
+	AuditLoginUnlock    = "login.unlock"
+	AuditJobTriggered   = "job.triggered"
+)
+
+// AuditEvent is one entry of the append-only audit_log collection.
+// Username is the account the event concerns, ActorID whoever caused it
+// when that is a logged-in user.
+type AuditEvent struct {
+	ID       primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Action   string              `bson:"action" json:"action"`
+	At       time.Time           `bson:"at" json:"at"`
+	Username string              `bson:"username,omitempty" json:"username,omitempty"`
+	ActorID  *primitive.ObjectID `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	IP       string              `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details  map[string]any      `bson:"details,omitempty" json:"details,omitempty"`
+}
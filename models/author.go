@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type YearCount struct {
+	Year  int `bson:"year" json:"year"`
+	Count int `bson:"count" json:"count"`
+}
+
+// AuthorMetrics is keyed by the author name exactly as it appears in
+// Paper.Authors.
+type AuthorMetrics struct {
+	Name             string      `bson:"_id" json:"name"`
+	Papers           int         `bson:"papers" json:"papers"`
+	TotalCitations   int         `bson:"total_citations" json:"total_citations"`
+	HIndex           int         `bson:"h_index" json:"h_index"`
+	I10Index         int         `bson:"i10_index" json:"i10_index"`
+	CitationsPerYear []YearCount `bson:"citations_per_year" json:"citations_per_year"`
+	UpdatedAt        time.Time   `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	AuthorCandidate = "candidate"
+	AuthorConfirmed = "confirmed"
+)
+
+// Author is a person behind one or more of the name strings found in
+// Paper.Authors. Aliases always includes Name.
+type Author struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Name      string              `bson:"name" json:"name"`
+	Aliases   []string            `bson:"aliases" json:"aliases"`
+	Key       string              `bson:"key" json:"-"`
+	Status    string              `bson:"status" json:"status"`
+	UserID    *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	ClaimPending  = "pending"
+	ClaimApproved = "approved"
+	ClaimRejected = "rejected"
+)
+
+type AuthorClaim struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	AuthorID  primitive.ObjectID  `bson:"author_id" json:"author_id"`
+	UserID    primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Note      string              `bson:"note,omitempty" json:"note,omitempty"`
+	Status    string              `bson:"status" json:"status"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+	DecidedAt *time.Time          `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	DecidedBy *primitive.ObjectID `bson:"decided_by,omitempty" json:"decided_by,omitempty"`
+}
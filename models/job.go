@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job run triggers and statuses.
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobRun is one run of a background job, kept in job_runs. A run whose
+// instance died stays "running" until the collection's TTL removes it.
+type JobRun struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Job         string              `bson:"job" json:"job"`
+	Instance    string              `bson:"instance" json:"instance"`
+	Trigger     string              `bson:"trigger" json:"trigger"`
+	TriggeredBy *primitive.ObjectID `bson:"triggered_by,omitempty" json:"triggered_by,omitempty"`
+	Status      string              `bson:"status" json:"status"`
+	StartedAt   time.Time           `bson:"started_at" json:"started_at"`
+	FinishedAt  *time.Time          `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Error       string              `bson:"error,omitempty" json:"error,omitempty"`
+}
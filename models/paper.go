@@ -1,24 +1,61 @@
 package models
 
 import (
-    "go.mongodb.org/mongo-driver/bson/primitive"
-    "time"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 type Paper struct {
-    ID               primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-    Title            string               `bson:"title" json:"title"`
-    Authors          []string             `bson:"authors" json:"authors"`
-    Abstract         string               `bson:"abstract" json:"abstract"`
-    PublicationDate  time.Time   `bson:"publication_date" json:"publication_date"`
-    JournalConference string              `bson:"journal_conference" json:"journal_conference"`
-    Keywords         []string             `bson:"keywords" json:"keywords"`
-    UploadedBy       primitive.ObjectID   `bson:"uploaded_by" json:"uploaded_by"`
-    Views            int                  `bson:"views" json:"views"`
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Title             string             `bson:"title" json:"title"`
+	Authors           []string           `bson:"authors" json:"authors"`
+	Abstract          string             `bson:"abstract" json:"abstract"`
+	PublicationDate   time.Time          `bson:"publication_date" json:"publication_date"`
+	JournalConference string             `bson:"journal_conference" json:"journal_conference"`
+	Keywords          []string           `bson:"keywords" json:"keywords"`
+	UploadedBy        primitive.ObjectID `bson:"uploaded_by" json:"uploaded_by"`
+	Views             int                `bson:"views" json:"views"`
+	// UniqueViewers is approximate, from a HyperLogLog in Redis.
+	UniqueViewers int64 `bson:"unique_viewers" json:"unique_viewers"`
+	// ViewSyncToken is the last batch of Redis views added to Views.
+	ViewSyncToken  string             `bson:"view_sync_token,omitempty" json:"-"`
+	Revision       int                `bson:"revision" json:"revision"`
+	PageRank       float64            `bson:"pagerank" json:"pagerank"`
+	HubScore       float64            `bson:"hub_score" json:"hub_score"`
+	AuthorityScore float64            `bson:"authority_score" json:"authority_score"`
+	DeletedAt      *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy      primitive.ObjectID `bson:"deleted_by,omitempty" json:"-"`
+	// MergedInto names the paper this duplicate was merged into; such papers
+	// wait in the trash for purging and cannot be restored.
+	MergedInto *primitive.ObjectID `bson:"merged_into,omitempty" json:"merged_into,omitempty"`
 }
 
 type Citation struct {
-    ID           primitive.ObjectID `bson:"_id,omitempty"`
-    PaperID      primitive.ObjectID `bson:"paper_id"`
-    CitedPaperID primitive.ObjectID `bson:"cited_paper_id"`
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	PaperID      primitive.ObjectID `bson:"paper_id"`
+	CitedPaperID primitive.ObjectID `bson:"cited_paper_id"`
+	// SourceDeleted is set while the citing paper sits in the trash, so the
+	// edge stops counting towards the cited paper without being lost.
+	SourceDeleted bool `bson:"source_deleted,omitempty"`
+}
+
+// PaperSnapshot is the editable part of a Paper as recorded in a revision.
+type PaperSnapshot struct {
+	Title             string    `bson:"title" json:"title"`
+	Authors           []string  `bson:"authors" json:"authors"`
+	Abstract          string    `bson:"abstract" json:"abstract"`
+	PublicationDate   time.Time `bson:"publication_date" json:"publication_date"`
+	JournalConference string    `bson:"journal_conference" json:"journal_conference"`
+	Keywords          []string  `bson:"keywords" json:"keywords"`
+}
+
+type PaperRevision struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PaperID      primitive.ObjectID `bson:"paper_id" json:"paper_id"`
+	Rev          int                `bson:"rev" json:"rev"`
+	EditedBy     primitive.ObjectID `bson:"edited_by" json:"edited_by"`
+	EditedAt     time.Time          `bson:"edited_at" json:"edited_at"`
+	Changed      []string           `bson:"changed" json:"changed"`
+	RestoredFrom *int               `bson:"restored_from,omitempty" json:"restored_from,omitempty"`
+	Snapshot     PaperSnapshot      `bson:"snapshot" json:"snapshot"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaperViewStat is one hour of views of one paper in the paper_view_stats
+// time-series collection.
+type PaperViewStat struct {
+	TS      time.Time          `bson:"ts"`
+	PaperID primitive.ObjectID `bson:"paper_id"`
+	Views   int64              `bson:"views"`
+}
+
+// StatsBucket is one interval of a paper's activity.
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Views     int64     `json:"views"`
+	Citations int64     `json:"citations"`
+}
@@ -1,14 +1,32 @@
 package models
 
 import (
-    "go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roles a user can hold. Every account is implicitly a member; admin and
+// curator are granted on top of that.
+const (
+	RoleAdmin   = "admin"
+	RoleCurator = "curator"
+	RoleMember  = "member"
 )
 
 type User struct {
-    ID         primitive.ObjectID `bson:\"_id,omitempty\" json:\"id\"`
-    Username   string             `bson:\"username\" json:\"username"`
-    Name       string             `bson:\"name\" json:\"name"`
-    Email      string             `bson:\"email\" json:\"email"`
-    Password   string             `bson:\"password\" json:\"-\"`
-    Department string             `bson:\"department\" json:\"department"`
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Username      string              `bson:"username" json:"username"`
+	Name          string              `bson:"name" json:"name"`
+	Email         string              `bson:"email" json:"email"`
+	Password      string              `bson:"password" json:"-"`
+	Department    string              `bson:"department" json:"department"`
+	EmailVerified bool                `bson:"email_verified" json:"email_verified"`
+	Roles         []string            `bson:"roles,omitempty" json:"roles"`
+	AuthorID      *primitive.ObjectID `bson:"author_id,omitempty" json:"author_id,omitempty"`
+	// TOTPSecret is only used once TOTPEnabled is set; until then an
+	// enrollment in progress keeps its secret in TOTPPendingSecret.
+	TOTPEnabled       bool     `bson:"totp_enabled" json:"totp_enabled"`
+	TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+	TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"`
+	TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`
+	RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`
 }
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"DB_HW5/config"
 	"DB_HW5/controllers"
 	"log"
 
@@ -11,20 +12,115 @@ import (
 
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
-	store, err := redis.NewStore(10, "tcp", "localhost:6379", "default", "123456", []byte("secret-key"))
+	store, err := redis.NewStore(10, "tcp", "localhost:6379", "default", "123456", config.Cfg.SessionSecret)
 	if err != nil {
 		log.Fatalf("failed to create redis store: %v", err)
 	}
 	r.Use(sessions.Sessions("mysession", store))
-	r.POST("/signup", controllers.SignUp)
-	r.POST("/login", controllers.Login)
+	public := r.Group("")
+	public.Use(controllers.RateLimit(controllers.BucketPublic))
+	{
+		public.POST("/signup", controllers.SignUp)
+		public.POST("/login", controllers.Login)
+		public.POST("/login/2fa", controllers.LoginTwoFactor)
+		public.POST("/token/refresh", controllers.RefreshToken)
+		public.POST("/token/revoke", controllers.RevokeToken)
+		public.POST("/password/forgot", controllers.ForgotPassword)
+		public.POST("/password/reset", controllers.ResetPassword)
+		public.GET("/verify-email", controllers.VerifyEmail)
+		public.POST("/verify-email", controllers.VerifyEmail)
+	}
 
 	auth := r.Group("")
-	auth.Use(controllers.AuthRequired())
+	auth.Use(
+		controllers.RateLimit(controllers.BucketIP),
+		controllers.AuthRequired(),
+		controllers.RateLimit(controllers.BucketAPI),
+	)
+
+	account := auth.Group("")
+	account.Use(controllers.RequirePermission(controllers.PermManageAccount))
+	{
+		account.POST("/logout", controllers.Logout)
+		account.GET("/me/sessions", controllers.ListSessions)
+		account.DELETE("/me/sessions", controllers.RevokeAllSessions)
+		account.DELETE("/me/sessions/:id", controllers.RevokeSession)
+		account.POST("/me/password", controllers.ChangePassword)
+		account.POST("/me/verify-email", controllers.ResendVerificationEmail)
+		account.GET("/me/api-keys", controllers.ListAPIKeys)
+		account.POST("/me/api-keys", controllers.CreateAPIKey)
+		account.DELETE("/me/api-keys/:id", controllers.RevokeAPIKey)
+		account.POST("/me/2fa/enroll", controllers.EnrollTOTP)
+		account.POST("/me/2fa/confirm", controllers.ConfirmTOTP)
+		account.POST("/me/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+		account.DELETE("/me/2fa", controllers.DisableTOTP)
+	}
+
+	read := auth.Group("")
+	read.Use(controllers.RequirePermission(controllers.PermReadPapers))
+	{
+		read.GET("/papers", controllers.SearchPapers)
+		read.GET("/papers/by-author/:author", controllers.PapersByAuthor)
+		read.GET("/papers/by-venue/:venue", controllers.PapersByVenue)
+		read.GET("/papers/:id", controllers.GetPaperDetails)
+		read.GET("/papers/trash", controllers.ListTrash)
+		read.GET("/papers/trending", controllers.GetTrendingPapers)
+		read.GET("/papers/:id/references", controllers.GetPaperReferences)
+		read.GET("/papers/:id/cited-by", controllers.GetPaperCitedBy)
+		read.GET("/papers/:id/ancestors", controllers.GetPaperAncestors)
+		read.GET("/papers/:id/descendants", controllers.GetPaperDescendants)
+		read.GET("/papers/:id/graph", controllers.GetCitationGraph)
+		read.GET("/papers/:id/path/:target", controllers.GetCitationPath)
+		read.GET("/papers/:id/stats", controllers.GetPaperStats)
+		read.GET("/papers/:id/revisions", controllers.ListPaperRevisions)
+		read.GET("/papers/:id/revisions/:rev", controllers.GetPaperRevision)
+		read.GET("/papers/:id/revisions/:rev/diff", controllers.DiffPaperRevisions)
+		read.GET("/authors/metrics", controllers.GetAuthorMetrics)
+		read.GET("/authors", controllers.ListAuthors)
+		read.GET("/authors/:id", controllers.GetAuthor)
+		read.GET("/authors/:id/papers", controllers.GetAuthorPapers)
+	}
+
+	// Ownership of individual papers is checked by the handlers; curators
+	// pass that check for every paper.
+	write := auth.Group("")
+	write.Use(controllers.RequirePermission(controllers.PermWritePapers))
+	{
+		write.POST("/papers", controllers.PostPaper)
+		write.PUT("/papers/:id", controllers.ReplacePaper)
+		write.PATCH("/papers/:id", controllers.UpdatePaper)
+		write.DELETE("/papers/:id", controllers.DeletePaper)
+		write.POST("/papers/:id/restore", controllers.RestorePaper)
+		write.POST("/papers/:id/revisions/:rev/restore", controllers.RestorePaperRevision)
+		write.POST("/authors/:id/claim", controllers.ClaimAuthor)
+	}
+
+	curate := auth.Group("")
+	curate.Use(controllers.RequirePermission(controllers.PermCuratePapers))
+	{
+		curate.POST("/papers/:id/merge", controllers.MergePapers)
+	}
+
+	authors := auth.Group("")
+	authors.Use(controllers.RequirePermission(controllers.PermCurateAuthors))
+	{
+		authors.GET("/authors/claims", controllers.ListAuthorClaims)
+		authors.POST("/authors/claims/:claim_id/approve", controllers.ApproveAuthorClaim)
+		authors.POST("/authors/claims/:claim_id/reject", controllers.RejectAuthorClaim)
+		authors.POST("/authors/:id/merge", controllers.MergeAuthors)
+	}
+
+	admin := auth.Group("/admin")
+	admin.Use(controllers.RequirePermission(controllers.PermManageUsers))
 	{
-		r.POST("/papers", controllers.PostPaper)
-		r.GET("/papers", controllers.SearchPapers)
-		r.GET("/papers/:id", controllers.GetPaperDetails)
+		admin.GET("/users", controllers.ListUsers)
+		admin.PUT("/users/:id/roles/:role", controllers.GrantRole)
+		admin.DELETE("/users/:id/roles/:role", controllers.RevokeRole)
+		admin.POST("/users/:id/unlock", controllers.UnlockUser)
+		admin.GET("/audit", controllers.ListAuditLog)
+		admin.GET("/jobs", controllers.ListJobs)
+		admin.GET("/jobs/:name/runs", controllers.ListJobRuns)
+		admin.POST("/jobs/:name/run", controllers.RunJob)
 	}
 	return r
 }
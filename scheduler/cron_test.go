@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want []string
+	}{
+		// Steps, ranges and lists.
+		{"*/5 * * * *", "2026-10-18 10:07:30", []string{"2026-10-18 10:10:00", "2026-10-18 10:15:00"}},
+		{"*/15 * * * *", "2026-10-18 10:45:00", []string{"2026-10-18 11:00:00", "2026-10-18 11:15:00"}},
+		{"10-20/5 8 * * *", "2026-10-18 08:12:00", []string{"2026-10-18 08:15:00", "2026-10-18 08:20:00", "2026-10-19 08:10:00"}},
+		{"5/20 * * * *", "2026-10-18 10:00:00", []string{"2026-10-18 10:05:00", "2026-10-18 10:25:00", "2026-10-18 10:45:00", "2026-10-18 11:05:00"}},
+		{"0 9,17 * * *", "2026-10-18 12:00:00", []string{"2026-10-18 17:00:00", "2026-10-19 09:00:00"}},
+		{"@hourly", "2026-10-18 10:00:00", []string{"2026-10-18 11:00:00", "2026-10-18 12:00:00"}},
+		{"@every 90s", "2026-10-18 10:07:30", []string{"2026-10-18 10:09:00", "2026-10-18 10:10:30"}},
+
+		// Day, month and year boundaries.
+		{"@daily", "2026-10-18 23:59:59", []string{"2026-10-19 00:00:00", "2026-10-20 00:00:00"}},
+		{"30 23 * * *", "2026-10-31 23:45:00", []string{"2026-11-01 23:30:00"}},
+		{"0 0 31 * *", "2026-09-15 00:00:00", []string{"2026-10-31 00:00:00", "2026-12-31 00:00:00", "2027-01-31 00:00:00"}},
+		{"0 0 1 1 *", "2026-12-31 23:59:00", []string{"2027-01-01 00:00:00", "2028-01-01 00:00:00"}},
+		{"59 23 31 12 *", "2026-12-31 23:59:00", []string{"2027-12-31 23:59:00"}},
+		{"0 0 29 2 *", "2026-10-18 00:00:00", []string{"2028-02-29 00:00:00", "2032-02-29 00:00:00"}},
+		{"0 12 * 2 *", "2027-02-28 12:00:00", []string{"2028-02-01 12:00:00"}},
+
+		// Weekdays; 2026-10-18 is a Sunday.
+		{"0 3 * * 1", "2026-10-18 10:00:00", []string{"2026-10-19 03:00:00", "2026-10-26 03:00:00"}},
+		{"0 0 * * 0", "2026-10-18 00:00:00", []string{"2026-10-25 00:00:00"}},
+		{"0 0 * * 7", "2026-10-18 00:00:00", []string{"2026-10-25 00:00:00"}},
+		{"0 0 * * 1-5", "2026-10-23 12:00:00", []string{"2026-10-26 00:00:00", "2026-10-27 00:00:00"}},
+		{"0 0 * * 6", "2026-12-27 00:00:00", []string{"2027-01-02 00:00:00"}},
+
+		// Both day fields restricted: either one matching is enough.
+		{"0 12 13 * 5", "2026-10-18 00:00:00", []string{"2026-10-23 12:00:00", "2026-10-30 12:00:00", "2026-11-06 12:00:00", "2026-11-13 12:00:00"}},
+		// Only one restricted: it alone decides.
+		{"0 12 13 * *", "2026-10-18 00:00:00", []string{"2026-11-13 12:00:00"}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		got := at(tt.from)
+		for _, w := range tt.want {
+			got = s.Next(got)
+			if !got.Equal(at(w)) {
+				t.Errorf("%q from %s: got %s, want %s", tt.spec, tt.from, got.Format(time.DateTime), w)
+				break
+			}
+		}
+	}
+}
+
+func TestScheduleNextIsUTC(t *testing.T) {
+	s, err := ParseSchedule("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 07:00 at UTC+5 is 02:00 UTC, an hour before the run.
+	loc := time.FixedZone("UTC+5", 5*60*60)
+	got := s.Next(time.Date(2026, 10, 18, 7, 0, 0, 0, loc))
+	if want := at("2026-10-18 03:00:00"); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseScheduleRejects(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+		"@weekly",
+		"@every",
+		"@every 1ms",
+		"@every soon",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"DB_HW5/utils"
+)
+
+// The application's own jobs. Schedules are UTC.
+func init() {
+	Register(Job{Name: "views_sync", Schedule: "@every 1m", Timeout: 5 * time.Minute, Run: syncViews})
+	// Decays the trending scores so that old activity fades out of
+	// GET /papers/trending.
+	Register(Job{Name: "trending_decay", Schedule: "*/5 * * * *", Timeout: time.Minute, Run: decayTrending})
+	Register(Job{Name: "view_stats_rollup", Schedule: "*/10 * * * *", Timeout: 5 * time.Minute, Run: rollupViewStats})
+	Register(Job{Name: "trash_purge", Schedule: "@hourly", Timeout: 30 * time.Minute, Run: purgeTrash})
+	Register(Job{Name: "pagerank", Schedule: "@every 1h", Timeout: 30 * time.Minute, Run: rankPapers})
+	// Handlers keep the affected authors' metrics current; the daily
+	// rebuild catches what they cannot see, such as papers removed by the
+	// purge job.
+	Register(Job{Name: "author_metrics", Schedule: "@daily", Timeout: 10 * time.Minute, Run: utils.RebuildAuthorMetrics})
+}
+
+func decayTrending(ctx context.Context) error {
+	return utils.DecayTrending(ctx, time.Now())
+}
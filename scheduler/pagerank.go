@@ -0,0 +1,237 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+)
+
+const (
+	pageRankDamping   = 0.85
+	pageRankTolerance = 1e-9
+	rankMaxIterations = 100
+	rankWriteBatch    = 1000
+)
+
+// citationGraph is the live citation graph with papers numbered 0..n-1.
+type citationGraph struct {
+	ids []primitive.ObjectID
+	out [][]int
+	in  [][]int
+}
+
+func loadCitationGraph(ctx context.Context) (*citationGraph, error) {
+	db := config.MongoClient.Database("research_db")
+
+	cur, err := db.Collection("papers").Find(ctx,
+		bson.M{"deleted_at": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var papers []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &papers); err != nil {
+		return nil, err
+	}
+
+	g := &citationGraph{
+		ids: make([]primitive.ObjectID, len(papers)),
+		out: make([][]int, len(papers)),
+		in:  make([][]int, len(papers)),
+	}
+	index := make(map[primitive.ObjectID]int, len(papers))
+	for i, p := range papers {
+		g.ids[i] = p.ID
+		index[p.ID] = i
+	}
+
+	cur, err = db.Collection("citations").Find(ctx,
+		bson.M{"source_deleted": bson.M{"$ne": true}},
+		options.Find().SetProjection(bson.M{"paper_id": 1, "cited_paper_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	seen := map[[2]int]bool{}
+	for cur.Next(ctx) {
+		var e struct {
+			From primitive.ObjectID `bson:"paper_id"`
+			To   primitive.ObjectID `bson:"cited_paper_id"`
+		}
+		if err := cur.Decode(&e); err != nil {
+			return nil, err
+		}
+		from, ok1 := index[e.From]
+		to, ok2 := index[e.To]
+		if !ok1 || !ok2 || from == to || seen[[2]int{from, to}] {
+			continue
+		}
+		seen[[2]int{from, to}] = true
+		g.out[from] = append(g.out[from], to)
+		g.in[to] = append(g.in[to], from)
+	}
+	return g, cur.Err()
+}
+
+// pageRank runs power iteration with uniform teleportation. Rank held by
+// papers that cite nothing is spread evenly over all papers. The result is
+// scaled by n so that an average paper scores 1.
+func pageRank(g *citationGraph) []float64 {
+	n := len(g.ids)
+	if n == 0 {
+		return nil
+	}
+	rank := make([]float64, n)
+	next := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+
+	for iter := 0; iter < rankMaxIterations; iter++ {
+		dangling := 0.0
+		for i := range rank {
+			if len(g.out[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-pageRankDamping)/float64(n) + pageRankDamping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, targets := range g.out {
+			if len(targets) == 0 {
+				continue
+			}
+			share := pageRankDamping * rank[i] / float64(len(targets))
+			for _, t := range targets {
+				next[t] += share
+			}
+		}
+
+		delta := 0.0
+		for i := range rank {
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+
+	for i := range rank {
+		rank[i] *= float64(n)
+	}
+	return rank
+}
+
+// hits computes Kleinberg hub and authority scores. A good authority is
+// cited by good hubs; a good hub cites good authorities. Both vectors are
+// L2-normalized.
+func hits(g *citationGraph) (hub, auth []float64) {
+	n := len(g.ids)
+	hub = make([]float64, n)
+	auth = make([]float64, n)
+	next := make([]float64, n)
+	for i := range hub {
+		hub[i] = 1
+	}
+	normalize(hub)
+
+	for iter := 0; iter < rankMaxIterations; iter++ {
+		for i := range auth {
+			auth[i] = 0
+			for _, src := range g.in[i] {
+				auth[i] += hub[src]
+			}
+		}
+		normalize(auth)
+
+		for i := range next {
+			next[i] = 0
+			for _, dst := range g.out[i] {
+				next[i] += auth[dst]
+			}
+		}
+		normalize(next)
+
+		delta := 0.0
+		for i := range hub {
+			delta += math.Abs(next[i] - hub[i])
+		}
+		hub, next = next, hub
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+	return hub, auth
+}
+
+func normalize(v []float64) {
+	sum := 0.0
+	for _, x := range v {
+		sum += x * x
+	}
+	if sum == 0 {
+		return
+	}
+	norm := math.Sqrt(sum)
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// rankPapers recomputes influence scores over the citation graph.
+func rankPapers(ctx context.Context) error {
+	start := time.Now()
+
+	g, err := loadCitationGraph(ctx)
+	if err != nil {
+		return err
+	}
+	if len(g.ids) == 0 {
+		return nil
+	}
+	rank := pageRank(g)
+	hub, auth := hits(g)
+
+	papersColl := config.MongoClient.Database("research_db").Collection("papers")
+	writes := make([]mongo.WriteModel, 0, rankWriteBatch)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := papersColl.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+	for i, id := range g.ids {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"pagerank":        rank[i],
+				"hub_score":       hub[i],
+				"authority_score": auth[i],
+			}}))
+		if len(writes) == rankWriteBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	log.Printf("ranked %d papers in %s", len(g.ids), time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"math"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// graph builds a citation graph on n papers; an edge {a, b} means a cites b.
+func graph(n int, edges ...[2]int) *citationGraph {
+	g := &citationGraph{
+		ids: make([]primitive.ObjectID, n),
+		out: make([][]int, n),
+		in:  make([][]int, n),
+	}
+	for _, e := range edges {
+		g.out[e[0]] = append(g.out[e[0]], e[1])
+		g.in[e[1]] = append(g.in[e[1]], e[0])
+	}
+	return g
+}
+
+func near(got, want []float64, tol float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPageRank(t *testing.T) {
+	tests := []struct {
+		desc string
+		g    *citationGraph
+		want []float64
+	}{
+		{"cycle", graph(3, [2]int{0, 1}, [2]int{1, 2}, [2]int{2, 0}), []float64{1, 1, 1}},
+		{"no citations", graph(3), []float64{1, 1, 1}},
+		// Both papers pass everything to the sink, which cites nothing and so
+		// spreads its rank over all three.
+		{"dangling sink", graph(3, [2]int{0, 2}, [2]int{1, 2}), []float64{30.0 / 47, 30.0 / 47, 81.0 / 47}},
+		{"star citing the centre", graph(4, [2]int{1, 0}, [2]int{2, 0}, [2]int{3, 0}),
+			[]float64{284.0 / 131, 80.0 / 131, 80.0 / 131, 80.0 / 131}},
+		{"star cited by the centre", graph(4, [2]int{0, 1}, [2]int{0, 2}, [2]int{0, 3}),
+			[]float64{80.0 / 97, 308.0 / 291, 308.0 / 291, 308.0 / 291}},
+	}
+	for _, tt := range tests {
+		rank := pageRank(tt.g)
+		sum := 0.0
+		for _, r := range rank {
+			sum += r
+		}
+		// Scaled so that the average paper scores 1.
+		if n := float64(len(tt.g.ids)); math.Abs(sum-n) > 1e-9 {
+			t.Errorf("%s: ranks sum to %v, want %v", tt.desc, sum, n)
+		}
+		if !near(rank, tt.want, 1e-6) {
+			t.Errorf("%s: got %v, want %v", tt.desc, rank, tt.want)
+		}
+	}
+
+	if rank := pageRank(graph(0)); rank != nil {
+		t.Errorf("empty graph: got %v, want nil", rank)
+	}
+}
+
+func TestHITS(t *testing.T) {
+	phi := (1 + math.Sqrt(5)) / 2
+	norm := math.Sqrt(1 + phi*phi)
+	third := 1 / math.Sqrt(3)
+	tests := []struct {
+		desc      string
+		g         *citationGraph
+		hub, auth []float64
+	}{
+		{"cycle", graph(3, [2]int{0, 1}, [2]int{1, 2}, [2]int{2, 0}),
+			[]float64{third, third, third}, []float64{third, third, third}},
+		{"star cited by the centre", graph(4, [2]int{0, 1}, [2]int{0, 2}, [2]int{0, 3}),
+			[]float64{1, 0, 0, 0}, []float64{0, third, third, third}},
+		{"star citing the centre", graph(4, [2]int{1, 0}, [2]int{2, 0}, [2]int{3, 0}),
+			[]float64{0, third, third, third}, []float64{1, 0, 0, 0}},
+		// Paper 0 cites 2 and 3, paper 1 cites only 3: the scores settle in
+		// the golden ratio.
+		{"overlapping references", graph(4, [2]int{0, 2}, [2]int{0, 3}, [2]int{1, 3}),
+			[]float64{phi / norm, 1 / norm, 0, 0}, []float64{0, 0, 1 / norm, phi / norm}},
+	}
+	for _, tt := range tests {
+		hub, auth := hits(tt.g)
+		if !near(hub, tt.hub, 1e-6) {
+			t.Errorf("%s: hubs %v, want %v", tt.desc, hub, tt.hub)
+		}
+		if !near(auth, tt.auth, 1e-6) {
+			t.Errorf("%s: authorities %v, want %v", tt.desc, auth, tt.auth)
+		}
+
+		// Converged: one more step from the result leaves it where it is.
+		nextAuth := make([]float64, len(auth))
+		nextHub := make([]float64, len(hub))
+		for i := range auth {
+			for _, src := range tt.g.in[i] {
+				nextAuth[i] += hub[src]
+			}
+			for _, dst := range tt.g.out[i] {
+				nextHub[i] += auth[dst]
+			}
+		}
+		normalize(nextAuth)
+		normalize(nextHub)
+		if !near(nextAuth, auth, 1e-9) || !near(nextHub, hub, 1e-9) {
+			t.Errorf("%s: not a fixed point: hubs %v -> %v, authorities %v -> %v",
+				tt.desc, hub, nextHub, auth, nextAuth)
+		}
+	}
+}
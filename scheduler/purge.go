@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/utils"
+)
+
+const purgeBatchSize = 500
+
+// purgeTrash permanently removes papers that have been in the trash longer
+// than config.Cfg.PaperRetention, together with every citation edge touching
+// them, their revisions, their view statistics and their Redis view
+// counters.
+func purgeTrash(ctx context.Context) error {
+	db := config.MongoClient.Database("research_db")
+	cutoff := time.Now().UTC().Add(-config.Cfg.PaperRetention)
+
+	for {
+		cur, err := db.Collection("papers").Find(ctx,
+			bson.M{"deleted_at": bson.M{"$lt": cutoff}},
+			options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(purgeBatchSize),
+		)
+		if err != nil {
+			return err
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.All(ctx, &docs); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		ids := make([]primitive.ObjectID, len(docs))
+		keys := make([]string, 0, 2*len(docs))
+		hexIDs := make([]string, len(docs))
+		for i, d := range docs {
+			ids[i] = d.ID
+			hexIDs[i] = d.ID.Hex()
+			keys = append(keys, utils.PaperViewsKey(hexIDs[i]), utils.PaperViewersKey(hexIDs[i]))
+		}
+
+		// Edges go first so a failure never leaves citations pointing at a
+		// paper that no longer exists.
+		if _, err := db.Collection("citations").DeleteMany(ctx, bson.M{"$or": bson.A{
+			bson.M{"paper_id": bson.M{"$in": ids}},
+			bson.M{"cited_paper_id": bson.M{"$in": ids}},
+		}}); err != nil {
+			return err
+		}
+		if _, err := db.Collection("paper_revisions").DeleteMany(ctx, bson.M{"paper_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		if _, err := db.Collection("paper_view_stats").DeleteMany(ctx, bson.M{"paper_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		if _, err := db.Collection("papers").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		_ = config.Redis.Del(ctx, keys...).Err()
+		_ = config.Redis.HDel(ctx, utils.PaperViewsPendingKey, hexIDs...).Err()
+		_ = config.Redis.SRem(ctx, utils.PaperViewersDirtyKey, hexIDs).Err()
+		_ = utils.RemoveTrending(ctx, hexIDs...)
+		log.Printf("purged %d papers from trash", len(ids))
+
+		if len(docs) < purgeBatchSize {
+			return nil
+		}
+	}
+}
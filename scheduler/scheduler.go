@@ -0,0 +1,331 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+// Job is a background task. Every instance registers the same jobs, but
+// only the one holding the scheduler lease runs them on schedule; a manual
+// trigger runs the job on the instance that received it. Either way a
+// per-job lock keeps runs of one job from overlapping.
+type Job struct {
+	Name string
+	// Schedule is parsed by ParseSchedule and evaluated in UTC.
+	Schedule string
+	// Timeout bounds a run. The job lock outlives it by lockMargin so an
+	// instance dying mid-run only blocks the job for that long.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+
+	schedule Schedule
+}
+
+const (
+	// tick is how often the leader checks for due jobs; cron schedules
+	// have minute resolution so this only needs to be well under that.
+	tick       = time.Second
+	lockMargin = time.Minute
+	// cancelGrace is how long cancelled runs get to return during shutdown
+	// before they are abandoned.
+	cancelGrace = 5 * time.Second
+)
+
+var (
+	ErrUnknownJob   = errors.New("unknown job")
+	ErrJobRunning   = errors.New("job is already running")
+	ErrShuttingDown = errors.New("scheduler is shutting down")
+)
+
+var (
+	jobs  = map[string]*Job{}
+	order []string
+
+	instanceID = newInstanceID()
+
+	mu       sync.Mutex
+	closed   bool
+	runs     sync.WaitGroup
+	runCtx   context.Context
+	stopRuns context.CancelFunc
+	stopLoop context.CancelFunc
+	loopDone chan struct{}
+)
+
+func init() {
+	runCtx, stopRuns = context.WithCancel(context.Background())
+}
+
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Register adds a job. It must be called before Start, and panics on a
+// duplicate name or a bad schedule since both are programming errors.
+func Register(j Job) {
+	if _, dup := jobs[j.Name]; dup {
+		panic("scheduler: duplicate job " + j.Name)
+	}
+	s, err := ParseSchedule(j.Schedule)
+	if err != nil {
+		panic("scheduler: job " + j.Name + ": " + err.Error())
+	}
+	j.schedule = s
+	jobs[j.Name] = &j
+	order = append(order, j.Name)
+}
+
+// Jobs returns the registered jobs in registration order.
+func Jobs() []Job {
+	out := make([]Job, 0, len(order))
+	for _, name := range order {
+		out = append(out, *jobs[name])
+	}
+	return out
+}
+
+// NextRun is when a job last started at last is next due.
+func (j Job) NextRun(last time.Time) time.Time {
+	if last.IsZero() {
+		return time.Now()
+	}
+	return j.schedule.Next(last)
+}
+
+// Start begins competing for the scheduler lease and, while holding it,
+// running jobs as they fall due.
+func Start() {
+	var ctx context.Context
+	ctx, stopLoop = context.WithCancel(context.Background())
+	loopDone = make(chan struct{})
+	go loop(ctx)
+}
+
+// Shutdown stops scheduling, hands the lease back and waits for running
+// jobs. Runs still going when ctx ends are cancelled and given cancelGrace
+// to return.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	closed = true
+	mu.Unlock()
+	if stopLoop != nil {
+		stopLoop()
+		<-loopDone
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	stopRuns()
+	select {
+	case <-done:
+	case <-time.After(cancelGrace):
+		log.Printf("scheduler: abandoning runs that ignored cancellation")
+	}
+	return ctx.Err()
+}
+
+func loop(ctx context.Context) {
+	defer close(loopDone)
+	ttl := config.Cfg.JobLeaseTTL
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	leader := false
+	var renewAt time.Time
+	next := map[string]time.Time{}
+	for {
+		now := time.Now()
+		if !now.Before(renewAt) {
+			was := leader
+			leader = holdLease(ctx, leader, ttl)
+			renewAt = now.Add(ttl / 3)
+			switch {
+			case leader && !was:
+				log.Printf("scheduler: %s acquired the lease", instanceID)
+				next = dueTimes(ctx, now)
+			case was && !leader:
+				log.Printf("scheduler: %s lost the lease", instanceID)
+			}
+		}
+		if leader {
+			for _, name := range order {
+				if now.Before(next[name]) {
+					continue
+				}
+				j := jobs[name]
+				next[name] = j.schedule.Next(now)
+				if _, err := startRun(j, models.JobTriggerSchedule, nil); err != nil && err != ErrJobRunning {
+					log.Printf("scheduler: %s: %v", name, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if leader {
+				rctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				_ = utils.ReleaseLock(rctx, utils.SchedulerLeaderKey, instanceID)
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// holdLease renews the lease if this instance has it and tries to take it
+// otherwise. An error counts as not holding it: a leader that cannot reach
+// Redis must assume another instance has taken over.
+func holdLease(ctx context.Context, leader bool, ttl time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var ok bool
+	var err error
+	if leader {
+		ok, err = utils.RenewLock(ctx, utils.SchedulerLeaderKey, instanceID, ttl)
+	} else {
+		ok, err = utils.AcquireLock(ctx, utils.SchedulerLeaderKey, instanceID, ttl)
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("scheduler lease error: %v", err)
+	}
+	return err == nil && ok
+}
+
+// dueTimes works out when each job is next due from its run history, so a
+// new leader catches up on runs missed during a restart or failover rather
+// than starting every schedule afresh.
+func dueTimes(ctx context.Context, now time.Time) map[string]time.Time {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	next := make(map[string]time.Time, len(order))
+	for _, name := range order {
+		j := jobs[name]
+		last, err := LastRun(ctx, name)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			next[name] = now
+		case err != nil:
+			log.Printf("scheduler: last run of %s: %v", name, err)
+			next[name] = j.schedule.Next(now)
+		default:
+			next[name] = j.NextRun(last.StartedAt)
+		}
+	}
+	return next
+}
+
+// LastRun returns the most recent run of a job.
+func LastRun(ctx context.Context, name string) (models.JobRun, error) {
+	var run models.JobRun
+	err := config.MongoClient.Database("research_db").Collection("job_runs").FindOne(ctx,
+		bson.M{"job": name},
+		options.FindOne().SetSort(bson.M{"started_at": -1})).Decode(&run)
+	return run, err
+}
+
+// Trigger runs a job now on this instance, on behalf of user by.
+func Trigger(name string, by primitive.ObjectID) (models.JobRun, error) {
+	j, ok := jobs[name]
+	if !ok {
+		return models.JobRun{}, ErrUnknownJob
+	}
+	return startRun(j, models.JobTriggerManual, &by)
+}
+
+// startRun takes the job lock, records the run and starts it in the
+// background. The run's ID doubles as the lock's owner.
+func startRun(j *Job, trigger string, by *primitive.ObjectID) (models.JobRun, error) {
+	mu.Lock()
+	if closed {
+		mu.Unlock()
+		return models.JobRun{}, ErrShuttingDown
+	}
+	runs.Add(1)
+	mu.Unlock()
+
+	run := models.JobRun{
+		ID:          primitive.NewObjectID(),
+		Job:         j.Name,
+		Instance:    instanceID,
+		Trigger:     trigger,
+		TriggeredBy: by,
+		Status:      models.JobRunning,
+		StartedAt:   time.Now().UTC(),
+	}
+	ctx, cancel := context.WithTimeout(runCtx, 5*time.Second)
+	defer cancel()
+	ok, err := utils.AcquireLock(ctx, utils.JobLockKey(j.Name), run.ID.Hex(), j.Timeout+lockMargin)
+	if err != nil || !ok {
+		runs.Done()
+		if err == nil {
+			err = ErrJobRunning
+		}
+		return models.JobRun{}, err
+	}
+	coll := config.MongoClient.Database("research_db").Collection("job_runs")
+	if _, err := coll.InsertOne(ctx, run); err != nil {
+		log.Printf("scheduler: recording run of %s: %v", j.Name, err)
+	}
+
+	go func() {
+		defer runs.Done()
+		err := execute(j)
+
+		finished := time.Now().UTC()
+		set := bson.M{"status": models.JobSucceeded, "finished_at": finished}
+		switch {
+		case err != nil && runCtx.Err() != nil:
+			set["status"] = models.JobCancelled
+			set["error"] = err.Error()
+		case err != nil:
+			set["status"] = models.JobFailed
+			set["error"] = err.Error()
+			log.Printf("job %s error: %v", j.Name, err)
+		}
+		// The run's own context may be gone by now.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := coll.UpdateByID(ctx, run.ID, bson.M{"$set": set}); err != nil {
+			log.Printf("scheduler: recording end of %s: %v", j.Name, err)
+		}
+		_ = utils.ReleaseLock(ctx, utils.JobLockKey(j.Name), run.ID.Hex())
+	}()
+	return run, nil
+}
+
+// execute runs j under its timeout, turning a panic into an error so one
+// bad run cannot take the process down.
+func execute(j *Job) (err error) {
+	ctx, cancel := context.WithTimeout(runCtx, j.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run(ctx)
+}
@@ -3,65 +3,72 @@ package scheduler
 import (
 	"context"
 	"log"
-	"strings"
-	"time"
-
-	"github.com/redis/go-redis/v9"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"DB_HW5/config"
+	"DB_HW5/utils"
 )
 
-func StartViewsSync() {
+const uniqueViewersBatch = 500
 
-	ticker := time.NewTicker(1 * time.Minute)
-	go func() {
-		for range ticker.C {
-			if err := syncOnce(); err != nil {
-				log.Printf("views sync error: %v", err)
-			}
-		}
-	}()
+// migrateViewCounters drops counters left by the old sync, which stored the
+// Mongo total in them rather than a delta and would otherwise be added to
+// Mongo a second time. Views recorded since the last old-style sync are
+// lost; that is at most one tick's worth.
+func migrateViewCounters(ctx context.Context) error {
+	done, err := config.Redis.Exists(ctx, utils.PaperViewsFormatKey).Result()
+	if err != nil || done > 0 {
+		return err
+	}
+	iter := config.Redis.Scan(ctx, 0, utils.PaperViewsPattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		_ = config.Redis.Del(ctx, iter.Val()).Err()
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return config.Redis.Set(ctx, utils.PaperViewsFormatKey, "delta", 0).Err()
 }
-func syncOnce() error {
-    ctx := context.Background()
-    iter := config.Redis.Scan(ctx, 0, "paper_views:*", 1000).Iterator()
-    for iter.Next(ctx) {
-        key := iter.Val()
-        idHex := strings.TrimPrefix(key, "paper_views:")
-        redisCount, err := config.Redis.Get(ctx, key).Int64()
-        if err != nil && err != redis.Nil {
-            continue
-        }
-        if redisCount <= 0 {
-            continue
-        }
-
-        oid, err := primitive.ObjectIDFromHex(idHex)
-        if err != nil {
-            continue
-        }
-
-        papersColl := config.MongoClient.Database("research_db").Collection("papers")
-
-
-        update := bson.M{"$inc": bson.M{"views": redisCount}}
-        _, err = papersColl.UpdateByID(ctx, oid, update)
-        if err != nil {
-            log.Printf("failed to update paper %s: %v", idHex, err)
-            continue
-        }
 
-        var paper struct{ Views int64 `bson:"views"` }
-        _ = papersColl.FindOne(ctx, bson.M{"_id": oid}).Decode(&paper)
-        _ = config.Redis.Set(ctx, key, paper.Views, 0).Err()
-
-		//_ = config.Redis.Set(ctx, key, 0, 0).Err()
-		//I know I should set it to zero but setting it to mongo value seemed better
+// syncViews moves view counts from Redis into papers.views, and unique
+// viewer counts into papers.unique_viewers. It first finishes claims an
+// earlier run left unacknowledged, then syncs every paper with new views.
+// See utils/views.go for how each batch of views is applied exactly once.
+func syncViews(ctx context.Context) error {
+	if err := migrateViewCounters(ctx); err != nil {
+		return err
+	}
 
+	pending, err := config.Redis.HKeys(ctx, utils.PaperViewsPendingKey).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range pending {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := utils.SyncViews(ctx, id); err != nil {
+			log.Printf("failed to sync views of paper %s: %v", id, err)
+		}
+	}
 
+	iter := config.Redis.Scan(ctx, 0, utils.PaperViewsPattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		id := utils.PaperIDFromViewsKey(iter.Val())
+		if _, err := utils.SyncViews(ctx, id); err != nil {
+			log.Printf("failed to sync views of paper %s: %v", id, err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
 
-    }
-    return iter.Err()
+	for {
+		n, err := utils.SyncUniqueViewers(ctx, uniqueViewersBatch)
+		if err != nil {
+			return err
+		}
+		if n < uniqueViewersBatch {
+			return nil
+		}
+	}
 }
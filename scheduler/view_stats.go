@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+	"DB_HW5/utils"
+)
+
+// rollupGrace leaves a finished hour alone for a little while, for requests
+// that picked its key just before the hour turned.
+const rollupGrace = 2 * time.Minute
+
+// rollupViewStats moves finished hourly view buckets from Redis into the
+// paper_view_stats time-series collection. It writes each finished hour in
+// one InsertMany and only then deletes its Redis hash. A crash in between
+// writes the hour again on the next run; the duplicates carry identical
+// counts, and the stats query collapses them by taking the maximum per
+// paper and hour.
+func rollupViewStats(ctx context.Context) error {
+	coll := config.MongoClient.Database("research_db").Collection("paper_view_stats")
+	cutoff := time.Now().UTC().Add(-rollupGrace).Truncate(time.Hour)
+
+	iter := config.Redis.Scan(ctx, 0, utils.PaperViewsHourlyPattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		hour, err := utils.HourFromViewsHourlyKey(key)
+		if err != nil || !hour.Before(cutoff) {
+			continue
+		}
+		counts, err := config.Redis.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		docs := make([]interface{}, 0, len(counts))
+		for id, v := range counts {
+			oid, err := primitive.ObjectIDFromHex(id)
+			n, err2 := strconv.ParseInt(v, 10, 64)
+			if err != nil || err2 != nil || n <= 0 {
+				continue
+			}
+			docs = append(docs, models.PaperViewStat{TS: hour, PaperID: oid, Views: n})
+		}
+		if len(docs) > 0 {
+			if _, err := coll.InsertMany(ctx, docs); err != nil {
+				return err
+			}
+		}
+		if err := config.Redis.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
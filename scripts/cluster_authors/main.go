@@ -0,0 +1,27 @@
+// Command cluster_authors groups the raw author strings stored on papers into
+// candidate Author identities. It is safe to run repeatedly.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"DB_HW5/config"
+	"DB_HW5/utils"
+)
+
+func main() {
+	config.Init()
+	utils.EnsureIndexes()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	stats, err := utils.ClusterAuthors(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Clustered %d author names: %d authors created, %d updated\n", stats.Names, stats.Created, stats.Updated)
+}
@@ -12,7 +12,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
+
+	"DB_HW5/utils"
 )
 
 type User struct {
@@ -73,14 +74,17 @@ func main() {
 		name := faker.Name()
 		email := faker.Email()
 		passPlain := faker.Password()
-		passHash, _ := bcrypt.GenerateFromPassword([]byte(passPlain), bcrypt.DefaultCost)
+		passHash, err := utils.HashPassword(passPlain)
+		if err != nil {
+			log.Fatal(err)
+		}
 		dept := faker.Word()
 
 		u := User{
 			Username:   username,
 			Name:       name,
 			Email:      email,
-			Password:   string(passHash),
+			Password:   passHash,
 			Department: dept,
 		}
 
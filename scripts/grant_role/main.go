@@ -0,0 +1,43 @@
+// Command grant_role gives a role to a user by username. It exists to
+// bootstrap the first admin; after that, admins use the /admin endpoints.
+//
+//	go run ./scripts/grant_role -user alice -role admin
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+func main() {
+	username := flag.String("user", "", "username to grant the role to")
+	role := flag.String("role", models.RoleAdmin, "role to grant (admin or curator)")
+	flag.Parse()
+	if *username == "" || (*role != models.RoleAdmin && *role != models.RoleCurator) {
+		flag.Usage()
+		log.Fatal("need -user and a -role of admin or curator")
+	}
+
+	config.Init()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := config.MongoClient.Database("research_db").Collection("users").UpdateOne(ctx,
+		bson.M{"username": *username}, bson.M{"$addToSet": bson.M{"roles": *role}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if res.MatchedCount == 0 {
+		log.Fatalf("no user named %q", *username)
+	}
+	fmt.Printf("Granted %s to %s\n", *role, *username)
+}
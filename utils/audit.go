@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+// Audit appends e to the audit log. Failing to record an event must not
+// fail the request that caused it, so errors are only logged.
+func Audit(ctx context.Context, e models.AuditEvent) {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	if _, err := config.MongoClient.Database("research_db").Collection("audit_log").InsertOne(ctx, e); err != nil {
+		log.Printf("audit %s: %v", e.Action, err)
+	}
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+// authorPaperPipeline yields, for each live paper matching match, its authors
+// and the publication year of every live paper citing it.
+func authorPaperPipeline(match bson.M) []bson.M {
+	match["deleted_at"] = bson.M{"$exists": false}
+	return []bson.M{
+		{"$match": match},
+		{"$lookup": bson.M{
+			"from":         "citations",
+			"localField":   "_id",
+			"foreignField": "cited_paper_id",
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"source_deleted": bson.M{"$ne": true}}},
+				bson.M{"$lookup": bson.M{
+					"from":         "papers",
+					"localField":   "paper_id",
+					"foreignField": "_id",
+					"pipeline":     bson.A{bson.M{"$project": bson.M{"publication_date": 1}}},
+					"as":           "src",
+				}},
+				bson.M{"$unwind": "$src"},
+				bson.M{"$project": bson.M{"_id": 0, "year": bson.M{"$year": "$src.publication_date"}}},
+			},
+			"as": "cites",
+		}},
+		{"$project": bson.M{"authors": 1, "years": "$cites.year"}},
+	}
+}
+
+// computeAuthorMetrics aggregates the papers selected by match into metrics
+// per author. If only is non-nil, co-authors outside it are ignored.
+func computeAuthorMetrics(ctx context.Context, match bson.M, only map[string]bool) (map[string]*models.AuthorMetrics, error) {
+	cur, err := config.MongoClient.Database("research_db").Collection("papers").
+		Aggregate(ctx, authorPaperPipeline(match))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	counts := map[string][]int{}
+	years := map[string]map[int]int{}
+	for cur.Next(ctx) {
+		var p struct {
+			Authors []string `bson:"authors"`
+			Years   []int    `bson:"years"`
+		}
+		if err := cur.Decode(&p); err != nil {
+			return nil, err
+		}
+		for _, a := range dedupe(p.Authors) {
+			if only != nil && !only[a] {
+				continue
+			}
+			counts[a] = append(counts[a], len(p.Years))
+			if years[a] == nil {
+				years[a] = map[int]int{}
+			}
+			for _, y := range p.Years {
+				years[a][y]++
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	out := make(map[string]*models.AuthorMetrics, len(counts))
+	for name, cites := range counts {
+		m := &models.AuthorMetrics{Name: name, Papers: len(cites), UpdatedAt: now}
+		sort.Sort(sort.Reverse(sort.IntSlice(cites)))
+		for i, n := range cites {
+			m.TotalCitations += n
+			if n >= i+1 {
+				m.HIndex = i + 1
+			}
+			if n >= 10 {
+				m.I10Index++
+			}
+		}
+		m.CitationsPerYear = []models.YearCount{}
+		for y, n := range years[name] {
+			m.CitationsPerYear = append(m.CitationsPerYear, models.YearCount{Year: y, Count: n})
+		}
+		sort.Slice(m.CitationsPerYear, func(i, j int) bool {
+			return m.CitationsPerYear[i].Year < m.CitationsPerYear[j].Year
+		})
+		out[name] = m
+	}
+	return out, nil
+}
+
+func dedupe(vals []string) []string {
+	seen := make(map[string]bool, len(vals))
+	out := vals[:0:0]
+	for _, v := range vals {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func saveAuthorMetrics(ctx context.Context, metrics map[string]*models.AuthorMetrics) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	writes := make([]mongo.WriteModel, 0, len(metrics))
+	for name, m := range metrics {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": name}).
+			SetReplacement(m).
+			SetUpsert(true))
+	}
+	_, err := config.MongoClient.Database("research_db").Collection("author_metrics").
+		BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// RefreshAuthorMetrics recomputes the metrics of the given authors only.
+// Authors left without any live paper lose their metrics document.
+func RefreshAuthorMetrics(ctx context.Context, names []string) error {
+	names = dedupe(names)
+	if len(names) == 0 {
+		return nil
+	}
+	only := make(map[string]bool, len(names))
+	for _, n := range names {
+		only[n] = true
+	}
+
+	metrics, err := computeAuthorMetrics(ctx, bson.M{"authors": bson.M{"$in": names}}, only)
+	if err != nil {
+		return err
+	}
+	if err := saveAuthorMetrics(ctx, metrics); err != nil {
+		return err
+	}
+
+	var gone []string
+	for _, n := range names {
+		if metrics[n] == nil {
+			gone = append(gone, n)
+		}
+	}
+	if len(gone) > 0 {
+		_, err = config.MongoClient.Database("research_db").Collection("author_metrics").
+			DeleteMany(ctx, bson.M{"_id": bson.M{"$in": gone}})
+	}
+	return err
+}
+
+// RefreshAuthorMetricsAsync runs RefreshAuthorMetrics in the background so
+// request handlers do not wait on it.
+func RefreshAuthorMetricsAsync(names []string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := RefreshAuthorMetrics(ctx, names); err != nil {
+			log.Printf("author metrics refresh error: %v", err)
+		}
+	}()
+}
+
+// RebuildAuthorMetrics recomputes metrics for every author and drops
+// documents for authors that no longer have papers.
+func RebuildAuthorMetrics(ctx context.Context) error {
+	start := time.Now().UTC()
+	metrics, err := computeAuthorMetrics(ctx, bson.M{}, nil)
+	if err != nil {
+		return err
+	}
+	if err := saveAuthorMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	_, err = config.MongoClient.Database("research_db").Collection("author_metrics").
+		DeleteMany(ctx, bson.M{"updated_at": bson.M{"$lt": start}})
+	return err
+}
@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"DB_HW5/config"
+	"DB_HW5/models"
+)
+
+// NormalizeAuthorName lowercases a name, turns "Last, First" into
+// "First Last", and reduces punctuation to single spaces.
+func NormalizeAuthorName(name string) string {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		name = first + " " + last
+	}
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// AuthorKey is the clustering key for a name: first name plus surname, so
+// "John Smith", "John A. Smith" and "Smith, John" all map to "john smith"
+// while "Jane Smith" stays apart. A bare initial stays an initial: "J. Smith"
+// maps to "j smith".
+func AuthorKey(name string) string {
+	parts := strings.Fields(NormalizeAuthorName(name))
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return parts[0]
+	}
+	return parts[0] + " " + parts[len(parts)-1]
+}
+
+// foldInitials moves groups keyed by an initial, such as "j smith", into the
+// one full-name group it can stand for. When several could match ("john
+// smith" and "jane smith") it is ambiguous and left as its own group.
+func foldInitials(groups map[string][]string) {
+	for key, names := range groups {
+		first, last, ok := strings.Cut(key, " ")
+		if !ok || len([]rune(first)) != 1 {
+			continue
+		}
+		var match string
+		n := 0
+		for other := range groups {
+			of, ol, ok := strings.Cut(other, " ")
+			if ok && ol == last && len([]rune(of)) > 1 && strings.HasPrefix(of, first) {
+				match = other
+				n++
+			}
+		}
+		if n == 1 {
+			groups[match] = append(groups[match], names...)
+			delete(groups, key)
+		}
+	}
+}
+
+// canonicalName picks the most complete spelling among aliases: the one with
+// the most name parts, then the longest, then the alphabetically first.
+func canonicalName(aliases []string) string {
+	best := ""
+	for _, a := range aliases {
+		na, nb := len(strings.Fields(NormalizeAuthorName(a))), len(strings.Fields(NormalizeAuthorName(best)))
+		if best == "" || na > nb || (na == nb && (len(a) > len(best) || (len(a) == len(best) && a < best))) {
+			best = a
+		}
+	}
+	return best
+}
+
+type ClusterStats struct {
+	Names   int `json:"names"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+// ClusterAuthors groups every distinct author string on papers by AuthorKey,
+// folding initials into the full name they unambiguously stand for, and
+// records each group as a candidate Author. Groups that overlap an
+// existing author, by key or by any alias, are folded into it instead, so
+// the migration can be re-run safely and does not undo manual merges.
+func ClusterAuthors(ctx context.Context) (ClusterStats, error) {
+	var stats ClusterStats
+	db := config.MongoClient.Database("research_db")
+
+	raw, err := db.Collection("papers").Distinct(ctx, "authors", bson.M{"deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		return stats, err
+	}
+	groups := map[string][]string{}
+	for _, v := range raw {
+		name, ok := v.(string)
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		stats.Names++
+		key := AuthorKey(name)
+		groups[key] = append(groups[key], name)
+	}
+	foldInitials(groups)
+
+	authors := db.Collection("authors")
+	now := time.Now().UTC()
+	for key, names := range groups {
+		created, updated, err := saveAuthorGroup(ctx, authors, key, names, now)
+		if err != nil {
+			return stats, err
+		}
+		if created {
+			stats.Created++
+		}
+		if updated {
+			stats.Updated++
+		}
+	}
+	return stats, nil
+}
+
+// saveAuthorGroup folds names into the author that already has key or any
+// of the names as an alias, or records them as a new candidate.
+func saveAuthorGroup(ctx context.Context, authors *mongo.Collection, key string, names []string, now time.Time) (created, updated bool, err error) {
+	var existing models.Author
+	err = authors.FindOne(ctx, bson.M{"$or": bson.A{
+		bson.M{"key": key},
+		bson.M{"aliases": bson.M{"$in": names}},
+	}}).Decode(&existing)
+	switch err {
+	case nil:
+		var missing []string
+		for _, n := range names {
+			if !slices.Contains(existing.Aliases, n) {
+				missing = append(missing, n)
+			}
+		}
+		if len(missing) == 0 {
+			return false, false, nil
+		}
+		if _, err := authors.UpdateByID(ctx, existing.ID, bson.M{
+			"$addToSet": bson.M{"aliases": bson.M{"$each": missing}},
+			"$set":      bson.M{"updated_at": now},
+		}); err != nil {
+			return false, false, err
+		}
+		return false, true, nil
+	case mongo.ErrNoDocuments:
+		_, err := authors.InsertOne(ctx, models.Author{
+			Name:      canonicalName(names),
+			Aliases:   names,
+			Key:       key,
+			Status:    models.AuthorCandidate,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err == nil {
+			return true, false, nil
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return false, false, nil
+		}
+		return false, false, err
+	default:
+		return false, false, err
+	}
+}
+
+// LinkAuthors attaches the author strings of a new or edited paper to
+// author identities the way ClusterAuthors would, so the authors collection
+// stays current between migration runs. An initial is folded against the
+// full names already on record.
+func LinkAuthors(ctx context.Context, names []string) error {
+	groups := map[string][]string{}
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		key := AuthorKey(name)
+		groups[key] = append(groups[key], name)
+	}
+
+	authors := config.MongoClient.Database("research_db").Collection("authors")
+	for key := range groups {
+		first, last, ok := strings.Cut(key, " ")
+		if !ok || len([]rune(first)) != 1 {
+			continue
+		}
+		known, err := authors.Distinct(ctx, "key", bson.M{"key": bson.M{
+			"$regex": "^" + regexp.QuoteMeta(first) + "[^ ]+ " + regexp.QuoteMeta(last) + "$",
+		}})
+		if err != nil {
+			return err
+		}
+		for _, k := range known {
+			if k, ok := k.(string); ok {
+				if _, seen := groups[k]; !seen {
+					groups[k] = nil
+				}
+			}
+		}
+	}
+	foldInitials(groups)
+
+	now := time.Now().UTC()
+	for key, names := range groups {
+		if len(names) == 0 {
+			continue
+		}
+		if _, _, err := saveAuthorGroup(ctx, authors, key, names, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkAuthorsAsync runs LinkAuthors in the background so that writes do not
+// wait on it; the next ClusterAuthors run picks up anything it misses.
+func LinkAuthorsAsync(names []string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := LinkAuthors(ctx, names); err != nil {
+			log.Printf("author linking error: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestAuthorKey(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"John Smith", "john smith"},
+		{"John A. Smith", "john smith"},
+		{"Smith, John", "john smith"},
+		{"  JOHN   smith ", "john smith"},
+		{"J. Smith", "j smith"},
+		{"J.A. Smith", "j smith"},
+		{"Jane Smith", "jane smith"},
+		{"Jean-Luc Picard", "jean picard"},
+		{"Madonna", "madonna"},
+		{"", ""},
+		{" .,", ""},
+	}
+	for _, tt := range tests {
+		if got := AuthorKey(tt.name); got != tt.want {
+			t.Errorf("AuthorKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFoldInitials(t *testing.T) {
+	tests := []struct {
+		desc   string
+		groups map[string][]string
+		want   map[string][]string
+	}{
+		{
+			desc:   "initial folds into the one full name",
+			groups: map[string][]string{"j smith": {"J. Smith"}, "john smith": {"John Smith"}},
+			want:   map[string][]string{"john smith": {"John Smith", "J. Smith"}},
+		},
+		{
+			desc:   "different full first names stay apart",
+			groups: map[string][]string{"john smith": {"John Smith"}, "jane smith": {"Jane Smith"}},
+			want:   map[string][]string{"john smith": {"John Smith"}, "jane smith": {"Jane Smith"}},
+		},
+		{
+			desc: "initial matching several full names stays apart",
+			groups: map[string][]string{
+				"j smith":    {"J. Smith"},
+				"john smith": {"John Smith"},
+				"jane smith": {"Jane Smith"},
+			},
+			want: map[string][]string{
+				"j smith":    {"J. Smith"},
+				"john smith": {"John Smith"},
+				"jane smith": {"Jane Smith"},
+			},
+		},
+		{
+			desc:   "initial needs the same surname",
+			groups: map[string][]string{"j smith": {"J. Smith"}, "john smyth": {"John Smyth"}},
+			want:   map[string][]string{"j smith": {"J. Smith"}, "john smyth": {"John Smyth"}},
+		},
+		{
+			desc:   "initial needs a matching first letter",
+			groups: map[string][]string{"j smith": {"J. Smith"}, "mary smith": {"Mary Smith"}},
+			want:   map[string][]string{"j smith": {"J. Smith"}, "mary smith": {"Mary Smith"}},
+		},
+		{
+			desc:   "initial alone stays",
+			groups: map[string][]string{"j smith": {"J. Smith", "Smith, J."}},
+			want:   map[string][]string{"j smith": {"J. Smith", "Smith, J."}},
+		},
+		{
+			desc:   "single name is left alone",
+			groups: map[string][]string{"m": {"M"}, "madonna": {"Madonna"}},
+			want:   map[string][]string{"m": {"M"}, "madonna": {"Madonna"}},
+		},
+	}
+	for _, tt := range tests {
+		foldInitials(tt.groups)
+		if !maps.EqualFunc(tt.groups, tt.want, slices.Equal[[]string]) {
+			t.Errorf("%s: got %v, want %v", tt.desc, tt.groups, tt.want)
+		}
+	}
+}
@@ -1,18 +1,112 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+
+	"DB_HW5/config"
+)
+
+// defaultHashing applies when config.Init has not run, e.g. in scripts.
+var defaultHashing = config.PasswordHashing{
+	Algorithm:     "argon2id",
+	BcryptCost:    12,
+	Argon2Time:    2,
+	Argon2Memory:  19 * 1024,
+	Argon2Threads: 1,
+}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
 )
 
+var errMalformedHash = errors.New("malformed password hash")
+
+func hashingPolicy() config.PasswordHashing {
+	if config.Cfg.PasswordHashing.Algorithm == "" {
+		return defaultHashing
+	}
+	return config.Cfg.PasswordHashing
+}
+
+// HashPassword hashes password under the configured policy. Argon2id hashes
+// use the PHC string format
+// $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>; bcrypt hashes
+// keep their native $2a$<cost>$ form.
 func HashPassword(password string) (string, error) {
-    bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-    return string(bytes), err
+	p := hashingPolicy()
+	if p.Algorithm == "bcrypt" {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		return string(bytes), err
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		p.Argon2Memory, p.Argon2Time, p.Argon2Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2(hash string) (argon2Hash, error) {
+	var h argon2Hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return h, errMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return h, errMalformedHash
+	}
+	var err1, err2 error
+	h.salt, err1 = base64.RawStdEncoding.DecodeString(parts[4])
+	h.key, err2 = base64.RawStdEncoding.DecodeString(parts[5])
+	if err1 != nil || err2 != nil || len(h.key) == 0 {
+		return h, errMalformedHash
+	}
+	return h, nil
+}
+
+// CheckPassword reports whether password matches hash, whichever supported
+// algorithm hash was made with.
+func CheckPassword(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		h, err := parseArgon2(hash)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(key, h.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
-func CheckPassword(password , hash string) bool {
-    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-    fmt.Println(err)
-    return err== nil
+// NeedsRehash reports whether hash was made under a policy other than the
+// current one, so that a successful login should replace it.
+func NeedsRehash(hash string) bool {
+	p := hashingPolicy()
+	if p.Algorithm == "bcrypt" {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != p.BcryptCost
+	}
+	h, err := parseArgon2(hash)
+	return err != nil || h.memory != p.Argon2Memory || h.time != p.Argon2Time ||
+		h.threads != p.Argon2Threads || len(h.salt) != argon2SaltLen || len(h.key) != argon2KeyLen
 }
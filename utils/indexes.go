@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"DB_HW5/config"
+)
+
+// EnsureIndexes creates the indexes the handlers rely on. The papers text
+// index weights title over keywords over abstract so that a title hit
+// outranks an abstract hit in $text scoring.
+func EnsureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db := config.MongoClient.Database("research_db")
+
+	ensure(ctx, db.Collection("users"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// A verified address belongs to one account, so password resets
+		// have a single recipient.
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().
+				SetName("users_verified_email").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email_verified": true}),
+		},
+	})
+
+	ensure(ctx, db.Collection("papers"), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "title", Value: "text"}, {Key: "abstract", Value: "text"}, {Key: "keywords", Value: "text"}},
+			Options: options.Index().
+				SetName("papers_text").
+				SetWeights(bson.D{{Key: "title", Value: 10}, {Key: "keywords", Value: 5}, {Key: "abstract", Value: 1}}).
+				SetDefaultLanguage("english"),
+		},
+		{Keys: bson.D{{Key: "uploaded_by", Value: 1}}},
+		{Keys: bson.D{{Key: "authors", Value: 1}}},
+		{Keys: bson.D{{Key: "publication_date", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+
+	ensure(ctx, db.Collection("citations"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "paper_id", Value: 1}}},
+		{Keys: bson.D{{Key: "cited_paper_id", Value: 1}}},
+	})
+
+	ensure(ctx, db.Collection("author_metrics"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "h_index", Value: -1}}},
+		{Keys: bson.D{{Key: "total_citations", Value: -1}}},
+	})
+
+	ensure(ctx, db.Collection("authors"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}},
+		{Keys: bson.D{{Key: "aliases", Value: 1}}},
+	})
+
+	ensure(ctx, db.Collection("author_claims"), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "author_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": "pending"}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+
+	ensure(ctx, db.Collection("paper_revisions"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "paper_id", Value: 1}, {Key: "rev", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+
+	ensure(ctx, db.Collection("api_keys"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+
+	ensureTimeSeries(ctx, db, "paper_view_stats", options.TimeSeries().
+		SetTimeField("ts").SetMetaField("paper_id").SetGranularity("hours"))
+	ensure(ctx, db.Collection("paper_view_stats"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "paper_id", Value: 1}, {Key: "ts", Value: 1}}},
+	})
+
+	ensure(ctx, db.Collection("audit_log"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "at", Value: -1}}},
+	})
+
+	ensure(ctx, db.Collection("job_runs"), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "started_at", Value: -1}}},
+		{Keys: bson.D{{Key: "started_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(jobRunRetention)},
+	})
+}
+
+// jobRunRetention is how long job run history is kept, in seconds.
+const jobRunRetention = 30 * 24 * 60 * 60
+
+// ensureTimeSeries creates a time-series collection unless it exists.
+func ensureTimeSeries(ctx context.Context, db *mongo.Database, name string, ts *options.TimeSeriesOptions) {
+	err := db.CreateCollection(ctx, name, options.CreateCollection().SetTimeSeriesOptions(ts))
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists") {
+		log.Fatalf("create time-series collection %s: %v", name, err)
+	}
+}
+
+func ensure(ctx context.Context, coll *mongo.Collection, models []mongo.IndexModel) {
+	if _, err := coll.Indexes().CreateMany(ctx, models); err != nil {
+		log.Fatalf("create indexes on %s: %v", coll.Name(), err)
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"DB_HW5/config"
+)
+
+// Locks are plain keys holding their owner's ID with the lease as TTL. Only
+// the owner may extend or release one, so a holder that stalled past its
+// lease cannot touch a lock someone else has since taken.
+
+var renewLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock takes key for owner unless someone else holds it.
+func AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	return config.Redis.SetNX(ctx, key, owner, ttl).Result()
+}
+
+// RenewLock extends owner's hold on key, reporting false if it was lost.
+func RenewLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewLock.Run(ctx, config.Redis, []string{key}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// ReleaseLock gives up owner's hold on key, if it still has it.
+func ReleaseLock(ctx context.Context, key, owner string) error {
+	return releaseLock.Run(ctx, config.Redis, []string{key}, owner).Err()
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	_ "embed"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MinPasswordLen = 8
+	// MaxPasswordBytes is bcrypt's input limit. It applies under every
+	// policy so that switching algorithms never locks anyone out.
+	MaxPasswordBytes = 72
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			m[strings.ToLower(line)] = true
+		}
+	}
+	return m
+}()
+
+var (
+	ErrPasswordTooShort   = errors.New("password must be at least 8 characters")
+	ErrPasswordTooLong    = errors.New("password must be at most 72 bytes")
+	ErrPasswordCommon     = errors.New("password is too common")
+	ErrPasswordIdentifier = errors.New("password must not contain your username or email")
+)
+
+// CheckPasswordStrength rejects passwords that are too short or long, that
+// appear in the bundled list of common and breached passwords, or that
+// are built from the account's own username or email.
+func CheckPasswordStrength(password, username, email string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLen {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return ErrPasswordCommon
+	}
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, id := range []string{strings.ToLower(username), local} {
+		if len(id) >= 3 && strings.Contains(lower, id) {
+			return ErrPasswordIdentifier
+		}
+	}
+	return nil
+}
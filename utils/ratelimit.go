@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"DB_HW5/config"
+)
+
+// A sliding window is a sorted set of hit timestamps (in milliseconds).
+// Hits older than the window are trimmed whenever the set is touched.
+var slidingWindowHit = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1] - ARGV[2])
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// SlidingWindowHit records a hit and returns how many hits the window now
+// holds.
+func SlidingWindowHit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	now := time.Now().UnixMilli()
+	member := strconv.FormatInt(now, 10) + "-" + RandomToken(6)
+	return slidingWindowHit.Run(ctx, config.Redis, []string{key},
+		now, window.Milliseconds(), member).Int64()
+}
+
+// SlidingWindowCount returns how many hits the window holds without adding
+// one, and when the oldest of them expires.
+func SlidingWindowCount(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	from := strconv.FormatInt(now.Add(-window).UnixMilli(), 10)
+	pipe := config.Redis.Pipeline()
+	count := pipe.ZCount(ctx, key, "("+from, "+inf")
+	oldest := pipe.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "(" + from, Max: "+inf", Count: 1})
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, now, err
+	}
+	expires := now
+	if z := oldest.Val(); len(z) > 0 {
+		expires = time.UnixMilli(int64(z[0].Score)).Add(window)
+	}
+	return count.Val(), expires, nil
+}
+
+var slidingWindowAllow = redis.NewScript(`
+local now, window, limit = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local n = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if n < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	n = n + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, n, reset}
+`)
+
+// SlidingWindowAllow records a hit unless the window already holds limit
+// hits. It returns whether the hit was allowed, how many hits the window
+// holds and how long until the oldest of them expires.
+func SlidingWindowAllow(ctx context.Context, key string, limit int, window time.Duration) (bool, int64, time.Duration, error) {
+	now := time.Now().UnixMilli()
+	member := strconv.FormatInt(now, 10) + "-" + RandomToken(6)
+	res, err := slidingWindowAllow.Run(ctx, config.Redis, []string{key},
+		now, window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil || len(res) != 3 {
+		return true, 0, 0, err
+	}
+	return res[0] == 1, res[1], time.Duration(res[2]) * time.Millisecond, nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+const RedisHashUsernames = "usernames"
+
+const paperViewsPrefix = "paper_views:"
+
+// PaperViewsKey counts views of a paper not yet handed to Mongo. It holds a
+// delta on top of papers.views, never a total.
+func PaperViewsKey(paperID string) string {
+	return paperViewsPrefix + paperID
+}
+
+// PaperViewsPattern matches every PaperViewsKey.
+const PaperViewsPattern = paperViewsPrefix + "*"
+
+// PaperIDFromViewsKey is the inverse of PaperViewsKey.
+func PaperIDFromViewsKey(key string) string {
+	return strings.TrimPrefix(key, paperViewsPrefix)
+}
+
+// PaperViewsPendingKey is a hash of view deltas claimed by a sync run but
+// not yet acknowledged, keyed by paper ID. Values are "<token>:<count>".
+const PaperViewsPendingKey = "paper_views_pending"
+
+// PaperViewersKey is a HyperLogLog of everyone who has viewed a paper.
+func PaperViewersKey(paperID string) string {
+	return "paper_viewers:" + paperID
+}
+
+// PaperViewersDirtyKey is the set of papers whose unique viewer count has
+// changed since it was last written to Mongo.
+const PaperViewersDirtyKey = "paper_viewers_dirty"
+
+// hourLayout names the hour a PaperViewsHourlyKey covers, in UTC.
+const hourLayout = "2006010215"
+
+const paperViewsHourlyPrefix = "paper_views_hourly:"
+
+// PaperViewsHourlyKey is a hash of views per paper ID during the hour
+// starting at hour. The scheduler rolls finished hours up into Mongo.
+func PaperViewsHourlyKey(hour time.Time) string {
+	return paperViewsHourlyPrefix + hour.UTC().Format(hourLayout)
+}
+
+// PaperViewsHourlyPattern matches every PaperViewsHourlyKey.
+const PaperViewsHourlyPattern = paperViewsHourlyPrefix + "*"
+
+// HourFromViewsHourlyKey is the inverse of PaperViewsHourlyKey.
+func HourFromViewsHourlyKey(key string) (time.Time, error) {
+	return time.Parse(hourLayout, strings.TrimPrefix(key, paperViewsHourlyPrefix))
+}
+
+// PaperViewsFormatKey marks that the PaperViewsKey counters hold deltas.
+// Older deployments kept a mirror of the Mongo total in them.
+const PaperViewsFormatKey = "paper_views_format"
+
+func RefreshTokenKey(tokenHash string) string {
+	return "refresh_token:" + tokenHash
+}
+
+// RefreshUsedKey remembers a rotated-out refresh token so that replaying it
+// can be detected.
+func RefreshUsedKey(tokenHash string) string {
+	return "refresh_used:" + tokenHash
+}
+
+func RefreshFamilyRevokedKey(family string) string {
+	return "refresh_family_revoked:" + family
+}
+
+func RevokedAccessTokenKey(jti string) string {
+	return "revoked_jti:" + jti
+}
+
+// UserSessionsKey is a hash of session ID to session metadata for one user.
+// A session (cookie or token family) is only valid while its field exists.
+func UserSessionsKey(userID string) string {
+	return "user_sessions:" + userID
+}
+
+// OneTimeTokenKey holds the state of a single-use emailed token.
+func OneTimeTokenKey(purpose, id string) string {
+	return "one_time_token:" + purpose + ":" + id
+}
+
+// OneTimeTokenUserKey points at the latest token of a purpose issued to a
+// user, so that issuing a new one can retire the old.
+func OneTimeTokenUserKey(purpose, userID string) string {
+	return "one_time_token_user:" + purpose + ":" + userID
+}
+
+// LoginChallengeKey holds a login that passed the password check and is
+// waiting for its second factor.
+func LoginChallengeKey(id string) string {
+	return "login_challenge:" + id
+}
+
+// Failed-login bookkeeping: sliding windows of failures per username and
+// per client IP, the temporary lock set when a username hits its limit, and
+// the short delay imposed between attempts once failures start piling up.
+func LoginFailuresUserKey(username string) string {
+	return "login_failures:user:" + username
+}
+
+func LoginFailuresIPKey(ip string) string {
+	return "login_failures:ip:" + ip
+}
+
+func LoginLockKey(username string) string {
+	return "login_lock:" + username
+}
+
+func LoginDelayKey(username string) string {
+	return "login_delay:" + username
+}
+
+// RateLimitKey holds the request window of one caller in one bucket.
+func RateLimitKey(bucket, caller string) string {
+	return "rate:" + bucket + ":" + caller
+}
+
+// TrendingKey is the sorted set of decayed activity scores for a trending
+// window such as "24h".
+func TrendingKey(window string) string {
+	return "trending:" + window
+}
+
+// TrendingDecayedAtKey remembers when a window's scores were last decayed.
+func TrendingDecayedAtKey(window string) string {
+	return "trending_decayed_at:" + window
+}
+
+// SchedulerLeaderKey holds the ID of the instance allowed to run scheduled
+// jobs, with the lease as its TTL.
+const SchedulerLeaderKey = "scheduler:leader"
+
+// JobLockKey is held while a job runs, on whichever instance, so that runs
+// of the same job never overlap.
+func JobLockKey(job string) string {
+	return "job_lock:" + job
+}
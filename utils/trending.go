@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"DB_HW5/config"
+)
+
+// TrendingWindows are the windows GET /papers/trending offers. A window's
+// scores halve every quarter of its length, so activity a full window old
+// weighs a sixteenth of fresh activity.
+var TrendingWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// Weights of the events that feed the trending scores. A new citation is
+// rarer and says more than a view.
+const (
+	TrendingViewWeight     = 1.0
+	TrendingCitationWeight = 25.0
+	// trendingFloor drops papers whose score has decayed into noise, so the
+	// sets only hold recently active papers.
+	trendingFloor = 0.05
+)
+
+func bumpTrending(ctx context.Context, pipe redis.Pipeliner, paperID string, weight float64) {
+	for w := range TrendingWindows {
+		pipe.ZIncrBy(ctx, TrendingKey(w), weight, paperID)
+	}
+}
+
+// BumpTrending adds weight to each paper's score in every window.
+func BumpTrending(ctx context.Context, weight float64, paperIDs ...string) error {
+	pipe := config.Redis.Pipeline()
+	for _, id := range paperIDs {
+		bumpTrending(ctx, pipe, id, weight)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RemoveTrending takes papers out of every window, e.g. when they are
+// deleted.
+func RemoveTrending(ctx context.Context, paperIDs ...string) error {
+	if len(paperIDs) == 0 {
+		return nil
+	}
+	pipe := config.Redis.Pipeline()
+	for w := range TrendingWindows {
+		pipe.ZRem(ctx, TrendingKey(w), paperIDs)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// MoveTrending adds from's scores to to's and removes from.
+func MoveTrending(ctx context.Context, from, to string) error {
+	for w := range TrendingWindows {
+		key := TrendingKey(w)
+		score, err := config.Redis.ZScore(ctx, key, from).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pipe := config.Redis.TxPipeline()
+		pipe.ZIncrBy(ctx, key, score, to)
+		pipe.ZRem(ctx, key, from)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecayTrending scales every score down by the time passed since the
+// window was last decayed, so a late or skipped run decays by the right
+// amount. Multiplying a sorted set in place is a single ZUNIONSTORE with a
+// weight, which keeps it atomic against concurrent increments.
+func DecayTrending(ctx context.Context, now time.Time) error {
+	for w, length := range TrendingWindows {
+		key := TrendingKey(w)
+		last, err := config.Redis.GetSet(ctx, TrendingDecayedAtKey(w), now.UnixMilli()).Int64()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		elapsed := now.Sub(time.UnixMilli(last))
+		if elapsed <= 0 {
+			continue
+		}
+		factor := math.Pow(0.5, elapsed.Seconds()/(length/4).Seconds())
+		pipe := config.Redis.TxPipeline()
+		pipe.ZUnionStore(ctx, key, &redis.ZStore{Keys: []string{key}, Weights: []float64{factor}})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatFloat(trendingFloor, 'f', -1, 64))
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
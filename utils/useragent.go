@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// botUserAgentRe matches agents that say they are crawlers or link
+// previewers. HTTP libraries are not matched: mobile apps, SDKs and
+// server-side clients of this API send those, and scripted traffic is left
+// to the rate limiter.
+var botUserAgentRe = regexp.MustCompile(`(?i)bot\b|bot/|crawl|spider|slurp|ia_archiver|` +
+	`facebookexternalhit|facebookcatalog|embedly|iframely|skypeuripreview|whatsapp/|vkshare`)
+
+// IsBotUserAgent reports whether ua looks automated. An empty user agent
+// counts as a bot.
+func IsBotUserAgent(ua string) bool {
+	return strings.TrimSpace(ua) == "" || botUserAgentRe.MatchString(ua)
+}
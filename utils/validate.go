@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"net/mail"
+	"regexp"
+	"unicode/utf8"
+)
+
+var usernameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+func ValidUsername(s string) bool {
+	return usernameRe.MatchString(s)
+}
+
+func ValidNonEmptyMax(s string, max int) bool {
+	n := utf8.RuneCountInString(s)
+	return n > 0 && n <= max
+}
+
+func ValidEmail(s string) bool {
+	if len(s) == 0 || len(s) > 254 {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
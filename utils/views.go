@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"DB_HW5/config"
+)
+
+// Views flow from Redis to Mongo in three steps, each safe to repeat:
+//
+//  1. claim: a Lua script moves a paper's delta counter into the pending
+//     hash under a fresh token. Increments arriving afterwards start a new
+//     delta, so none are lost. A paper with an unacknowledged claim gets that
+//     same claim back instead of a new one.
+//  2. apply: Mongo adds the count and records the token in one update that
+//     only matches while the token is not yet recorded, so replaying a claim
+//     after a crash adds nothing.
+//  3. ack: the pending entry is removed if it still holds that claim.
+
+var claimViews = redis.NewScript(`
+local pending = redis.call('HGET', KEYS[2], ARGV[1])
+if pending then
+	return pending
+end
+local n = tonumber(redis.call('GETDEL', KEYS[1]) or '0')
+if n <= 0 then
+	return false
+end
+local claim = ARGV[2] .. ':' .. n
+redis.call('HSET', KEYS[2], ARGV[1], claim)
+return claim
+`)
+
+var ackViews = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// ViewClaim is a batch of views of one paper on its way to Mongo.
+type ViewClaim struct {
+	PaperID string
+	Token   string
+	Count   int64
+	raw     string
+}
+
+func parseViewClaim(paperID, raw string) (ViewClaim, bool) {
+	token, count, ok := strings.Cut(raw, ":")
+	n, err := strconv.ParseInt(count, 10, 64)
+	if !ok || err != nil {
+		return ViewClaim{}, false
+	}
+	return ViewClaim{PaperID: paperID, Token: token, Count: n, raw: raw}, true
+}
+
+// hourlyViewsTTL keeps hourly buckets around long enough for the rollup
+// job to catch up after an outage, without letting them pile up forever.
+const hourlyViewsTTL = 7 * 24 * time.Hour
+
+// RecordView counts one view of paperID by viewerID: towards raw views, the
+// paper's unique viewers and the current hour's bucket.
+func RecordView(ctx context.Context, paperID, viewerID string) error {
+	pipe := config.Redis.Pipeline()
+	pipe.Incr(ctx, PaperViewsKey(paperID))
+	pipe.PFAdd(ctx, PaperViewersKey(paperID), viewerID)
+	pipe.SAdd(ctx, PaperViewersDirtyKey, paperID)
+	hourly := PaperViewsHourlyKey(time.Now())
+	pipe.HIncrBy(ctx, hourly, paperID, 1)
+	pipe.Expire(ctx, hourly, hourlyViewsTTL)
+	bumpTrending(ctx, pipe, paperID, TrendingViewWeight)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// UniqueViewers returns the approximate number of distinct viewers of
+// paperID that Redis has seen.
+func UniqueViewers(ctx context.Context, paperID string) (int64, error) {
+	return config.Redis.PFCount(ctx, PaperViewersKey(paperID)).Result()
+}
+
+// SyncUniqueViewers writes the unique viewer count of up to batch papers
+// whose count changed into papers.unique_viewers. Counts only ever grow, and
+// $max keeps Mongo from going backwards should Redis lose a HyperLogLog.
+func SyncUniqueViewers(ctx context.Context, batch int64) (int, error) {
+	ids, err := config.Redis.SPopN(ctx, PaperViewersDirtyKey, batch).Result()
+	if err != nil {
+		return 0, err
+	}
+	papers := config.MongoClient.Database("research_db").Collection("papers")
+	for i, id := range ids {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		n, err := UniqueViewers(ctx, id)
+		if err == nil {
+			_, err = papers.UpdateByID(ctx, oid, bson.M{"$max": bson.M{"unique_viewers": n}})
+		}
+		if err != nil {
+			// Put back whatever was not written, for the next run.
+			_ = config.Redis.SAdd(ctx, PaperViewersDirtyKey, ids[i:]).Err()
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// UnsyncedViews returns the views of paperID that Mongo does not reflect
+// yet. appliedToken is the paper's view_sync_token, which tells whether a
+// pending claim has in fact already reached Mongo.
+func UnsyncedViews(ctx context.Context, paperID, appliedToken string) (int64, error) {
+	pipe := config.Redis.Pipeline()
+	delta := pipe.Get(ctx, PaperViewsKey(paperID))
+	pending := pipe.HGet(ctx, PaperViewsPendingKey, paperID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+	n, _ := delta.Int64()
+	if claim, ok := parseViewClaim(paperID, pending.Val()); ok && claim.Token != appliedToken {
+		n += claim.Count
+	}
+	return n, nil
+}
+
+// ClaimViews takes paperID's current delta, or its unacknowledged claim,
+// for syncing. ok is false when there is nothing to sync.
+func ClaimViews(ctx context.Context, paperID string) (claim ViewClaim, ok bool, err error) {
+	raw, err := claimViews.Run(ctx, config.Redis,
+		[]string{PaperViewsKey(paperID), PaperViewsPendingKey}, paperID, RandomToken(12)).Text()
+	if err == redis.Nil {
+		return claim, false, nil
+	}
+	if err != nil {
+		return claim, false, err
+	}
+	claim, ok = parseViewClaim(paperID, raw)
+	return claim, ok, nil
+}
+
+// ApplyViews adds claim to papers.views unless it was already added.
+func ApplyViews(ctx context.Context, claim ViewClaim) error {
+	oid, err := primitive.ObjectIDFromHex(claim.PaperID)
+	if err != nil {
+		return nil
+	}
+	_, err = config.MongoClient.Database("research_db").Collection("papers").UpdateOne(ctx,
+		bson.M{"_id": oid, "view_sync_token": bson.M{"$ne": claim.Token}},
+		bson.M{"$inc": bson.M{"views": claim.Count}, "$set": bson.M{"view_sync_token": claim.Token}})
+	return err
+}
+
+// AckViews drops claim from the pending hash once it is in Mongo.
+func AckViews(ctx context.Context, claim ViewClaim) error {
+	return ackViews.Run(ctx, config.Redis, []string{PaperViewsPendingKey}, claim.PaperID, claim.raw).Err()
+}
+
+// applyViews is ApplyViews, swappable so tests can stand in for Mongo.
+var applyViews = ApplyViews
+
+// SyncViews runs claim, apply and ack for one paper.
+func SyncViews(ctx context.Context, paperID string) (int64, error) {
+	claim, ok, err := ClaimViews(ctx, paperID)
+	if err != nil || !ok {
+		return 0, err
+	}
+	if err := applyViews(ctx, claim); err != nil {
+		return 0, err
+	}
+	return claim.Count, AckViews(ctx, claim)
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"DB_HW5/config"
+)
+
+const testPaperID = "65f000000000000000000001"
+
+// fakePaper stands in for a papers document. apply mirrors ApplyViews'
+// update: the count is only added while the claim's token is not recorded.
+type fakePaper struct {
+	mu      sync.Mutex
+	views   int64
+	token   string
+	applies int
+}
+
+func (p *fakePaper) apply(_ context.Context, claim ViewClaim) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != claim.Token {
+		p.views += claim.Count
+		p.token = claim.Token
+		p.applies++
+	}
+	return nil
+}
+
+func (p *fakePaper) state() (int64, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.views, p.token
+}
+
+func setupViews(t *testing.T) *fakePaper {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	config.Redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = config.Redis.Close() })
+
+	p := &fakePaper{}
+	orig := applyViews
+	applyViews = p.apply
+	t.Cleanup(func() { applyViews = orig })
+	return p
+}
+
+func recordViews(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := RecordView(context.Background(), testPaperID, "viewer"); err != nil {
+			t.Fatalf("RecordView: %v", err)
+		}
+	}
+}
+
+func TestSyncViewsConcurrentWithRecordView(t *testing.T) {
+	p := setupViews(t)
+	ctx := context.Background()
+	const writers, perWriter = 8, 250
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := RecordView(ctx, testPaperID, "viewer"); err != nil {
+					t.Errorf("RecordView: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for syncing := true; syncing; {
+		select {
+		case <-done:
+			syncing = false
+		default:
+		}
+		if _, err := SyncViews(ctx, testPaperID); err != nil {
+			t.Fatalf("SyncViews: %v", err)
+		}
+	}
+	if _, err := SyncViews(ctx, testPaperID); err != nil {
+		t.Fatalf("SyncViews: %v", err)
+	}
+
+	if views, _ := p.state(); views != writers*perWriter {
+		t.Fatalf("views = %d, want %d", views, writers*perWriter)
+	}
+	if n, err := UnsyncedViews(ctx, testPaperID, ""); err != nil || n != 0 {
+		t.Fatalf("UnsyncedViews = %d, %v; want 0", n, err)
+	}
+}
+
+func TestSyncViewsReplayAfterCrash(t *testing.T) {
+	p := setupViews(t)
+	ctx := context.Background()
+	recordViews(t, 5)
+
+	// Crash after apply, before ack: the claim stays pending.
+	claim, ok, err := ClaimViews(ctx, testPaperID)
+	if err != nil || !ok {
+		t.Fatalf("ClaimViews = %v, %v", ok, err)
+	}
+	if err := applyViews(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	recordViews(t, 3)
+
+	// The next run gets the same claim back, and replaying it adds nothing.
+	n, err := SyncViews(ctx, testPaperID)
+	if err != nil {
+		t.Fatalf("SyncViews: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("replayed claim count = %d, want 5", n)
+	}
+	if views, _ := p.state(); views != 5 || p.applies != 1 {
+		t.Fatalf("after replay views = %d, applies = %d; want 5, 1", views, p.applies)
+	}
+	if pending, _ := config.Redis.HExists(ctx, PaperViewsPendingKey, testPaperID).Result(); pending {
+		t.Fatal("claim still pending after replay")
+	}
+
+	// Views recorded after the crash go out in a fresh claim.
+	if _, err := SyncViews(ctx, testPaperID); err != nil {
+		t.Fatalf("SyncViews: %v", err)
+	}
+	if views, _ := p.state(); views != 8 {
+		t.Fatalf("views = %d, want 8", views)
+	}
+}
+
+func TestUnsyncedViewsWithPendingClaim(t *testing.T) {
+	p := setupViews(t)
+	ctx := context.Background()
+	recordViews(t, 5)
+
+	claim, ok, err := ClaimViews(ctx, testPaperID)
+	if err != nil || !ok {
+		t.Fatalf("ClaimViews = %v, %v", ok, err)
+	}
+	recordViews(t, 3)
+
+	// Not yet applied: Mongo has none of the claim.
+	if n, err := UnsyncedViews(ctx, testPaperID, ""); err != nil || n != 8 {
+		t.Fatalf("before apply UnsyncedViews = %d, %v; want 8", n, err)
+	}
+
+	// Applied but not acked: the paper's token shows the claim arrived.
+	if err := applyViews(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	_, token := p.state()
+	if n, err := UnsyncedViews(ctx, testPaperID, token); err != nil || n != 3 {
+		t.Fatalf("after apply UnsyncedViews = %d, %v; want 3", n, err)
+	}
+
+	if err := AckViews(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := UnsyncedViews(ctx, testPaperID, token); err != nil || n != 3 {
+		t.Fatalf("after ack UnsyncedViews = %d, %v; want 3", n, err)
+	}
+}